@@ -1,45 +1,108 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 	"github.com/yangzuo0621/monitor/pkg/monitor"
 )
 
 func createRootCmd() *cobra.Command {
-	var configPath string
+	var (
+		configPath    string
+		listenAddress string
+	)
 
 	c := &cobra.Command{
 		Use:          "monitor",
 		Short:        "monitor CI/CD process",
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			configContent, err := ioutil.ReadFile(configPath)
-			if err != nil {
-				return err
-			}
-			var c monitor.Config
-			err = json.Unmarshal(configContent, &c)
+			return runMonitor(configPath, listenAddress)
+		},
+	}
+
+	c.PersistentFlags().StringVar(&configPath, "config", "", "config file path")
+	c.MarkPersistentFlagRequired("config")
+	c.Flags().StringVar(&listenAddress, "listen-address", ":8080", "address of the status server, empty to disable it")
+
+	c.AddCommand(createStateCmd(&configPath))
+	c.AddCommand(createReconcileCmd(&configPath))
+
+	return c
+}
+
+// runMonitor runs the monitor loop and the status server on listenAddress until a signal is received
+func runMonitor(configPath string, listenAddress string) error {
+	m, err := buildMonitor(configPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signalContext()
+	defer cancel()
+
+	serverErr := make(chan error, 1)
+	if listenAddress != "" {
+		go func() {
+			err := m.Serve(ctx, listenAddress)
 			if err != nil {
-				return err
+				logger.WithError(err).Error("status server stopped")
+				cancel()
 			}
+			serverErr <- err
+		}()
+	} else {
+		serverErr <- nil
+	}
 
-			client := monitor.BuildClient(
-				storageAccessKey,
-				personalAccessToken,
-				&c,
-				logger,
-			)
-
-			client.MonitorRoutine()
-			return nil
-		},
+	err = m.Run(ctx)
+	cancel()
+	if sErr := <-serverErr; err == nil {
+		err = sErr
 	}
+	return err
+}
 
-	c.Flags().StringVar(&configPath, "config", "", "config file path")
-	c.MarkFlagRequired("config")
+// signalContext returns a context canceled once SIGTERM or SIGINT is received
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
 
-	return c
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			logger.Infof("received signal %s, shutting down", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// buildMonitor builds the monitor from the config file at configPath
+func buildMonitor(configPath string) (*monitor.Monitor, error) {
+	configContent, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	var c monitor.Config
+	err = json.Unmarshal(configContent, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	return monitor.BuildMonitor(
+		storageAccessKey,
+		personalAccessToken,
+		&c,
+		logger,
+	)
 }
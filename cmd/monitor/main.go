@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 
 	"github.com/sirupsen/logrus"
@@ -23,22 +24,25 @@ func init() {
 		"source": "monitor",
 	})
 
+	// storage access key is only required by the blob state store, which is validated when building the client
 	storageAccessKey = os.Getenv(storageAccessKeyKey)
-	if storageAccessKey == "" {
-		logger.Fatalln("env storageAccessKey not set")
-		os.Exit(-1)
-	}
 	personalAccessToken = os.Getenv(personalAccessTokenKey)
+}
+
+func main() {
+	// the token is checked here rather than in init, so that the tests of the package can run without it
 	if personalAccessToken == "" {
 		logger.Fatalln("env personalAccessToken not set")
 		os.Exit(-1)
 	}
-}
 
-func main() {
 	rootCmd := createRootCmd()
 
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(-1)
 	}
 
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/monitor"
+)
+
+// exit codes of `reconcile --once`, the worst outcome among the flows is returned
+const (
+	exitSucceeded          = 0
+	exitCycleFailed        = 1
+	exitInProgress         = 2
+	exitPartiallySucceeded = 3
+	exitFailed             = 4
+	exitSkipped            = 5
+	exitLeaderActive       = 6
+)
+
+// exitSeverity orders the exit codes from the best to the worst outcome
+var exitSeverity = map[int]int{
+	exitSucceeded:          0,
+	exitSkipped:            1,
+	exitInProgress:         2,
+	exitPartiallySucceeded: 3,
+	exitFailed:             4,
+	exitCycleFailed:        5,
+}
+
+// exitError makes the process exit with code
+type exitError struct {
+	code    int
+	message string
+}
+
+func (e *exitError) Error() string {
+	return e.message
+}
+
+func createReconcileCmd(configPath *string) *cobra.Command {
+	var (
+		once   bool
+		dryRun bool
+		flow   string
+	)
+
+	c := &cobra.Command{
+		Use:   "reconcile",
+		Short: "reconcile the CI/CD process without the status server",
+		Long: `Reconcile the CI/CD process without the status server.
+
+With --once a single cycle runs and the exit code reflects the state of the day:
+  0  the release succeeded
+  1  the cycle failed
+  2  the day is in progress or paused
+  3  the release partially succeeded
+  4  the build or the release failed
+  5  the day was skipped for a freeze, as nothing new was validated or as
+     earlier days were unfinished
+  6  another replica holds the leader lease, no cycle ran
+
+With leader election enabled the cycle holds the leader lease, a dry run
+runs without it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !once {
+				if dryRun {
+					return fmt.Errorf("--dry-run requires --once")
+				}
+				return runMonitor(*configPath, "")
+			}
+
+			m, err := buildMonitor(*configPath)
+			if err != nil {
+				return err
+			}
+			if flow != "" {
+				if m, err = m.Select(flow); err != nil {
+					return err
+				}
+			}
+			if dryRun {
+				m.EnableDryRun()
+			}
+
+			ctx, cancel := signalContext()
+			defer cancel()
+
+			results, err := m.ReconcileOnce(ctx)
+			if errors.Is(err, monitor.ErrLeaderActive) {
+				return &exitError{code: exitLeaderActive, message: err.Error()}
+			}
+			if err != nil {
+				return err
+			}
+			if dryRun {
+				for _, r := range results {
+					printPlan(r)
+				}
+			}
+			return onceExitError(results)
+		},
+	}
+
+	c.Flags().BoolVar(&once, "once", false, "run a single cycle and exit with a code reflecting the state of the day")
+	c.Flags().BoolVar(&dryRun, "dry-run", false, "print what the cycle would do without writing to azure devops or the state store")
+	c.Flags().StringVar(&flow, "flow", "", "name of the flow to reconcile, all flows if not set")
+	return c
+}
+
+// onceExitError returns the exitError of the worst outcome among the cycles of the flows, nil if
+// every release succeeded
+func onceExitError(results []*monitor.CycleResult) error {
+	code := exitSucceeded
+	var messages []string
+	for _, r := range results {
+		c, message := cycleExitCode(r)
+		if exitSeverity[c] > exitSeverity[code] {
+			code = c
+		}
+		messages = append(messages, message)
+	}
+	if code == exitSucceeded {
+		return nil
+	}
+	return &exitError{code: code, message: strings.Join(messages, "; ")}
+}
+
+// cycleExitCode returns the exit code of the outcome of the cycle of a flow
+func cycleExitCode(r *monitor.CycleResult) (int, string) {
+	if r.Err != nil {
+		return exitCycleFailed, fmt.Sprintf("flow %s: %s", r.Flow, r.Err)
+	}
+
+	message := fmt.Sprintf("flow %s: CI/CD of %s is %s", r.Flow, r.Data.Date, r.Data.State)
+	if r.Data.Paused {
+		return exitInProgress, message + " and paused"
+	}
+	switch r.Data.State {
+	case cicd.DataStateValues.ReleaseSucceeded:
+		return exitSucceeded, message
+	case cicd.DataStateValues.ReleasePartiallySucceeded:
+		return exitPartiallySucceeded, message
+	case cicd.DataStateValues.SkippedFreeze, cicd.DataStateValues.NoChanges, cicd.DataStateValues.SkippedOverlap:
+		return exitSkipped, message
+	}
+	if r.Data.State.IsTerminal() {
+		return exitFailed, message
+	}
+	return exitInProgress, message
+}
+
+func printPlan(r *monitor.CycleResult) {
+	fmt.Fprintf(os.Stdout, "flow %s:\n", r.Flow)
+	if len(r.Plan) == 0 {
+		fmt.Fprintln(os.Stdout, "  nothing to do")
+	}
+	for _, action := range r.Plan {
+		fmt.Fprintf(os.Stdout, "  would %s\n", action)
+	}
+	if r.Data != nil {
+		fmt.Fprintf(os.Stdout, "  state would be %s\n", r.Data.State)
+	}
+}
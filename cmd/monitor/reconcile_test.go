@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/monitor"
+)
+
+func TestCycleExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		result *monitor.CycleResult
+		want   int
+	}{
+		{
+			name:   "cycle failed",
+			result: &monitor.CycleResult{Err: errors.New("azure devops is down")},
+			want:   exitCycleFailed,
+		},
+		{
+			name:   "release succeeded",
+			result: &monitor.CycleResult{Data: &cicd.Data{State: cicd.DataStateValues.ReleaseSucceeded}},
+			want:   exitSucceeded,
+		},
+		{
+			name:   "build running",
+			result: &monitor.CycleResult{Data: &cicd.Data{State: cicd.DataStateValues.BuildInProgress}},
+			want:   exitInProgress,
+		},
+		{
+			name:   "paused",
+			result: &monitor.CycleResult{Data: &cicd.Data{State: cicd.DataStateValues.ReleaseSucceeded, Paused: true}},
+			want:   exitInProgress,
+		},
+		{
+			name:   "release partially succeeded",
+			result: &monitor.CycleResult{Data: &cicd.Data{State: cicd.DataStateValues.ReleasePartiallySucceeded}},
+			want:   exitPartiallySucceeded,
+		},
+		{
+			name:   "build abandoned",
+			result: &monitor.CycleResult{Data: &cicd.Data{State: cicd.DataStateValues.BuildAbandoned}},
+			want:   exitFailed,
+		},
+		{
+			name:   "release rejected",
+			result: &monitor.CycleResult{Data: &cicd.Data{State: cicd.DataStateValues.ReleaseRejected}},
+			want:   exitFailed,
+		},
+		{
+			name:   "no changes",
+			result: &monitor.CycleResult{Data: &cicd.Data{State: cicd.DataStateValues.NoChanges}},
+			want:   exitSkipped,
+		},
+		{
+			name:   "skipped for a freeze",
+			result: &monitor.CycleResult{Data: &cicd.Data{State: cicd.DataStateValues.SkippedFreeze}},
+			want:   exitSkipped,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.result.Flow = "test"
+			if got, message := cycleExitCode(tt.result); got != tt.want {
+				t.Errorf("cycleExitCode() = %d (%s), want %d", got, message, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnceExitError(t *testing.T) {
+	result := func(state cicd.DataState) *monitor.CycleResult {
+		return &monitor.CycleResult{Flow: string(state), Data: &cicd.Data{State: state}}
+	}
+
+	tests := []struct {
+		name    string
+		results []*monitor.CycleResult
+		want    int
+	}{
+		{
+			name:    "every release succeeded",
+			results: []*monitor.CycleResult{result(cicd.DataStateValues.ReleaseSucceeded), result(cicd.DataStateValues.ReleaseSucceeded)},
+			want:    exitSucceeded,
+		},
+		{
+			name:    "a flow is skipped",
+			results: []*monitor.CycleResult{result(cicd.DataStateValues.ReleaseSucceeded), result(cicd.DataStateValues.NoChanges)},
+			want:    exitSkipped,
+		},
+		{
+			name:    "failure is worse than progress",
+			results: []*monitor.CycleResult{result(cicd.DataStateValues.ReleaseFailed), result(cicd.DataStateValues.BuildInProgress)},
+			want:    exitFailed,
+		},
+		{
+			name:    "failed cycle is the worst",
+			results: []*monitor.CycleResult{result(cicd.DataStateValues.ReleaseFailed), {Flow: "down", Err: errors.New("timeout")}},
+			want:    exitCycleFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := onceExitError(tt.results)
+			code := exitSucceeded
+			var exitErr *exitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.code
+			} else if err != nil {
+				t.Fatalf("onceExitError() = %v, want an exitError", err)
+			}
+			if code != tt.want {
+				t.Errorf("exit code = %d (%v), want %d", code, err, tt.want)
+			}
+		})
+	}
+}
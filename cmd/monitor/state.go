@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/monitor"
+)
+
+// stateOptions are the flags shared by the state commands
+type stateOptions struct {
+	configPath *string
+	flow       string
+	date       string
+	reason     string
+}
+
+// client returns the client of the selected flow and the selected date, today if not set
+func (o *stateOptions) client() (*monitor.MonitorClient, string, error) {
+	m, err := buildMonitor(*o.configPath)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := m.Client(o.flow)
+	if err != nil {
+		return nil, "", err
+	}
+
+	date := o.date
+	if date == "" {
+		date = client.Today()
+	}
+	return client, date, nil
+}
+
+func createStateCmd(configPath *string) *cobra.Command {
+	o := &stateOptions{configPath: configPath}
+
+	c := &cobra.Command{
+		Use:   "state",
+		Short: "inspect and repair the CI/CD data of a day",
+	}
+	c.PersistentFlags().StringVar(&o.flow, "flow", "", "name of the flow, required if several flows are declared")
+	c.PersistentFlags().StringVar(&o.date, "date", "", "date of the day as 2006-01-02, today if not set")
+
+	c.AddCommand(
+		&cobra.Command{
+			Use:   "get",
+			Short: "print the data of the day",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				client, date, err := o.client()
+				if err != nil {
+					return err
+				}
+				data, err := client.GetDay(context.Background(), date)
+				if err != nil {
+					return err
+				}
+				return printData(data)
+			},
+		},
+		withReason(o, &cobra.Command{
+			Use:   "set <state>",
+			Short: "move the day to a state, the stages after the state run again or the day ends",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				state, err := cicd.ParseDataState(args[0])
+				if err != nil {
+					return err
+				}
+				client, date, err := o.client()
+				if err != nil {
+					return err
+				}
+				data, err := client.SetState(context.Background(), date, state, o.reason)
+				if err != nil {
+					return err
+				}
+				return printData(data)
+			},
+		}),
+		withReason(o, &cobra.Command{
+			Use:   "reset",
+			Short: "start the day over",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				client, date, err := o.client()
+				if err != nil {
+					return err
+				}
+				data, err := client.ResetDay(context.Background(), date, o.reason)
+				if err != nil {
+					return err
+				}
+				return printData(data)
+			},
+		}),
+		createPauseCmd(o, "pause", "stop the monitor from moving the day forward", true),
+		createPauseCmd(o, "resume", "let the monitor move the day forward again", false),
+		createFreezeOverrideCmd(o),
+	)
+	return c
+}
+
+func createPauseCmd(o *stateOptions, use string, short string, paused bool) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, date, err := o.client()
+			if err != nil {
+				return err
+			}
+			data, err := client.SetPaused(context.Background(), date, paused)
+			if err != nil {
+				return err
+			}
+			return printData(data)
+		},
+	}
+}
+
+func createFreezeOverrideCmd(o *stateOptions) *cobra.Command {
+	var disable bool
+
+	c := withReason(o, &cobra.Command{
+		Use:   "freeze-override",
+		Short: "let the day start builds and releases during a freeze, for emergency releases",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, date, err := o.client()
+			if err != nil {
+				return err
+			}
+			data, err := client.SetFreezeOverride(context.Background(), date, !disable, o.reason)
+			if err != nil {
+				return err
+			}
+			return printData(data)
+		},
+	})
+	c.Flags().BoolVar(&disable, "disable", false, "respect the freeze again")
+	return c
+}
+
+func withReason(o *stateOptions, c *cobra.Command) *cobra.Command {
+	c.Flags().StringVar(&o.reason, "reason", "", "reason recorded in the events of the day")
+	return c
+}
+
+func printData(data *cicd.Data) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(data)
+}
@@ -0,0 +1,90 @@
+package calendar
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Calendar tells whether a time falls into a blackout: a blackout weekday, an event declared
+// inline or an event of an iCalendar file. The file is read again whenever it is modified, so
+// that freeze windows can be declared without restarting the monitor.
+type Calendar struct {
+	location *time.Location
+	weekdays map[time.Weekday]bool
+	events   []*Event
+	icsFile  string
+
+	mu         sync.Mutex
+	icsEvents  []*Event
+	icsModTime time.Time
+}
+
+// New creates a Calendar, weekdays are evaluated in location
+func New(location *time.Location, weekdays []time.Weekday, events []*Event, icsFile string) *Calendar {
+	c := &Calendar{
+		location: location,
+		weekdays: map[time.Weekday]bool{},
+		events:   events,
+		icsFile:  icsFile,
+	}
+	for _, d := range weekdays {
+		c.weekdays[d] = true
+	}
+	return c
+}
+
+// Blackout returns the reason why t is in a blackout, false is returned if it isn't. An error is
+// returned if the iCalendar file can't be read.
+func (c *Calendar) Blackout(t time.Time) (string, bool, error) {
+	if c == nil {
+		return "", false, nil
+	}
+
+	if day := t.In(c.location).Weekday(); c.weekdays[day] {
+		return day.String(), true, nil
+	}
+	for _, e := range c.events {
+		if e.Contains(t) {
+			return e.Summary, true, nil
+		}
+	}
+
+	events, err := c.fileEvents()
+	if err != nil {
+		return "", false, err
+	}
+	for _, e := range events {
+		if e.Contains(t) {
+			return e.Summary, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// fileEvents returns the events of the iCalendar file, read again if it was modified
+func (c *Calendar) fileEvents() ([]*Event, error) {
+	if c.icsFile == "" {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, err := os.Stat(c.icsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read calendar: %w", err)
+	}
+	if info.ModTime().Equal(c.icsModTime) {
+		return c.icsEvents, nil
+	}
+
+	events, err := LoadICS(c.icsFile, c.location)
+	if err != nil {
+		return nil, fmt.Errorf("read calendar: %w", err)
+	}
+	c.icsEvents = events
+	c.icsModTime = info.ModTime()
+	return events, nil
+}
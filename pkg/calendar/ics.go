@@ -0,0 +1,154 @@
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	icsDateFormat      = "20060102"
+	icsLocalTimeFormat = "20060102T150405"
+	icsUTCTimeFormat   = "20060102T150405Z"
+)
+
+// Event is a time range of a calendar, End is exclusive
+type Event struct {
+	Summary string
+	Start   time.Time
+	End     time.Time
+}
+
+// Contains checks whether t is within the event
+func (e *Event) Contains(t time.Time) bool {
+	return !t.Before(e.Start) && t.Before(e.End)
+}
+
+// LoadICS reads the events of the iCalendar file at path, see ParseICS
+func LoadICS(path string, location *time.Location) ([]*Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events, err := ParseICS(f, location)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return events, nil
+}
+
+// ParseICS reads the VEVENT components of an iCalendar stream. Dates and floating times are in
+// location, an event without DTEND lasts one day if it starts on a date and is instantaneous
+// otherwise. Recurrence rules aren't supported, recurring events only have their first occurrence.
+func ParseICS(r io.Reader, location *time.Location) ([]*Event, error) {
+	lines, err := unfoldLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		events []*Event
+		event  *Event
+		allDay bool
+	)
+	for i, line := range lines {
+		name, params, value, ok := splitContentLine(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &Event{}
+			allDay = false
+		case name == "END" && value == "VEVENT":
+			if event == nil || event.Start.IsZero() {
+				return nil, fmt.Errorf("line %d: event without DTSTART", i+1)
+			}
+			if event.End.IsZero() {
+				event.End = event.Start
+				if allDay {
+					event.End = event.Start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, event)
+			event = nil
+		case event == nil:
+		case name == "SUMMARY":
+			event.Summary = value
+		case name == "DTSTART":
+			t, date, err := parseICSTime(params, value, location)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			event.Start, allDay = t, date
+		case name == "DTEND":
+			t, _, err := parseICSTime(params, value, location)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			event.End = t
+		}
+	}
+	return events, nil
+}
+
+// unfoldLines joins the lines continued by a leading space or tab
+func unfoldLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitContentLine splits "NAME;PARAM=VALUE:value" into its name, parameters and value
+func splitContentLine(line string) (string, map[string]string, string, bool) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", nil, "", false
+	}
+
+	parts := strings.Split(line[:i], ";")
+	params := map[string]string{}
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[i+1:], true
+}
+
+// parseICSTime parses a DATE or DATE-TIME value, true is returned for dates
+func parseICSTime(params map[string]string, value string, location *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(icsDateFormat) {
+		t, err := time.ParseInLocation(icsDateFormat, value, location)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(icsUTCTimeFormat, value)
+		return t, false, err
+	}
+
+	if tzid, ok := params["TZID"]; ok {
+		tz, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		location = tz
+	}
+	t, err := time.ParseInLocation(icsLocalTimeFormat, value, location)
+	return t, false, err
+}
@@ -0,0 +1,119 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseICS(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ics     string
+		want    []Event
+		wantErr bool
+	}{
+		{
+			name: "all day event without end",
+			ics:  "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nSUMMARY:Holiday\r\nDTSTART;VALUE=DATE:20211001\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+			want: []Event{{
+				Summary: "Holiday",
+				Start:   time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC),
+				End:     time.Date(2021, 10, 2, 0, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "UTC times",
+			ics:  "BEGIN:VEVENT\nSUMMARY:Maintenance\nDTSTART:20211001T100000Z\nDTEND:20211001T120000Z\nEND:VEVENT\n",
+			want: []Event{{
+				Summary: "Maintenance",
+				Start:   time.Date(2021, 10, 1, 10, 0, 0, 0, time.UTC),
+				End:     time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "TZID and folded summary",
+			ics:  "BEGIN:VEVENT\nSUMMARY:Golden\n  week\nDTSTART;TZID=Asia/Shanghai:20211001T000000\nDTEND;TZID=Asia/Shanghai:20211008T000000\nEND:VEVENT\n",
+			want: []Event{{
+				Summary: "Golden week",
+				Start:   time.Date(2021, 10, 1, 0, 0, 0, 0, shanghai),
+				End:     time.Date(2021, 10, 8, 0, 0, 0, 0, shanghai),
+			}},
+		},
+		{
+			name: "floating time and instantaneous event",
+			ics:  "BEGIN:VEVENT\nDTSTART:20211001T080000\nEND:VEVENT\n",
+			want: []Event{{
+				Start: time.Date(2021, 10, 1, 8, 0, 0, 0, time.UTC),
+				End:   time.Date(2021, 10, 1, 8, 0, 0, 0, time.UTC),
+			}},
+		},
+		{
+			name: "properties outside of events are ignored",
+			ics:  "BEGIN:VCALENDAR\nX-WR-CALNAME:Freeze\nBEGIN:VEVENT\nDTSTART:20211001\nEND:VEVENT\nBEGIN:VEVENT\nDTSTART:20211003\nEND:VEVENT\n",
+			want: []Event{
+				{Start: time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2021, 10, 2, 0, 0, 0, 0, time.UTC)},
+				{Start: time.Date(2021, 10, 3, 0, 0, 0, 0, time.UTC), End: time.Date(2021, 10, 4, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:    "event without start",
+			ics:     "BEGIN:VEVENT\nSUMMARY:Broken\nEND:VEVENT\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid time",
+			ics:     "BEGIN:VEVENT\nDTSTART:2021-10-01T00:00\nEND:VEVENT\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown TZID",
+			ics:     "BEGIN:VEVENT\nDTSTART;TZID=Mars/Olympus:20211001T000000\nEND:VEVENT\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := ParseICS(strings.NewReader(tt.ics), time.UTC)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseICS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(events) != len(tt.want) {
+				t.Fatalf("ParseICS() = %d events, want %d", len(events), len(tt.want))
+			}
+			for i, e := range events {
+				w := tt.want[i]
+				if e.Summary != w.Summary || !e.Start.Equal(w.Start) || !e.End.Equal(w.End) {
+					t.Errorf("event %d = %+v, want %+v", i, *e, w)
+				}
+			}
+		})
+	}
+}
+
+func TestEventContains(t *testing.T) {
+	e := &Event{
+		Start: time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC),
+		End:   time.Date(2021, 10, 2, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{e.Start, true},
+		{e.End.Add(-time.Second), true},
+		{e.End, false},
+		{e.Start.Add(-time.Second), false},
+	}
+	for _, tt := range tests {
+		if got := e.Contains(tt.t); got != tt.want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
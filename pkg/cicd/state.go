@@ -0,0 +1,252 @@
+package cicd
+
+import (
+	"fmt"
+	"time"
+)
+
+// transitions lists the states each DataState is allowed to move to
+var transitions = map[DataState][]DataState{
+	DataStateValues.None:            {DataStateValues.NotStart, DataStateValues.BuildSucceeded, DataStateValues.SkippedFreeze, DataStateValues.NoChanges, DataStateValues.SkippedOverlap},
+	DataStateValues.NotStart:        {DataStateValues.BuildInProgress, DataStateValues.BuildSucceeded, DataStateValues.BuildFailed, DataStateValues.BuildTimedOut},
+	DataStateValues.BuildInProgress: {DataStateValues.BuildSucceeded, DataStateValues.BuildFailed, DataStateValues.BuildTimedOut},
+	DataStateValues.BuildFailed:     {DataStateValues.NotStart, DataStateValues.BuildAbandoned},
+	DataStateValues.BuildSucceeded:  {DataStateValues.ReleaseInProgress},
+	DataStateValues.ReleaseInProgress: {
+		DataStateValues.ReleaseSucceeded,
+		DataStateValues.ReleasePartiallySucceeded,
+		DataStateValues.ReleaseFailed,
+		DataStateValues.ReleaseRejected,
+		DataStateValues.ReleaseCanceled,
+		DataStateValues.ReleaseTimedOut,
+	},
+}
+
+// dataStates lists every DataState
+var dataStates = []DataState{
+	DataStateValues.None,
+	DataStateValues.NotStart,
+	DataStateValues.BuildInProgress,
+	DataStateValues.BuildFailed,
+	DataStateValues.BuildAbandoned,
+	DataStateValues.BuildSucceeded,
+	DataStateValues.ReleaseInProgress,
+	DataStateValues.ReleaseFailed,
+	DataStateValues.ReleaseSucceeded,
+	DataStateValues.ReleasePartiallySucceeded,
+	DataStateValues.ReleaseRejected,
+	DataStateValues.ReleaseCanceled,
+	DataStateValues.SkippedFreeze,
+	DataStateValues.NoChanges,
+	DataStateValues.BuildTimedOut,
+	DataStateValues.ReleaseTimedOut,
+	DataStateValues.SkippedOverlap,
+}
+
+// ParseDataState returns the DataState named name, an error is returned for unknown states
+func ParseDataState(name string) (DataState, error) {
+	for _, s := range dataStates {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown data state %q", name)
+}
+
+// TransitionError is returned when a DataState is asked to move to a state the transition table doesn't allow
+type TransitionError struct {
+	From DataState
+	To   DataState
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("invalid data state transition from %q to %q", e.From, e.To)
+}
+
+// CanTransitionTo checks whether the state is allowed to move to next
+func (s DataState) CanTransitionTo(next DataState) bool {
+	if s == next {
+		return true
+	}
+	for _, v := range transitions[s] {
+		if v == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal checks whether the state is a final outcome of the day
+func (s DataState) IsTerminal() bool {
+	_, ok := transitions[s]
+	return !ok
+}
+
+// TransitionTo moves the data to next state and records the transition as an event with reason,
+// an error is returned for illegal transitions
+func (d *Data) TransitionTo(next DataState, reason string) error {
+	if !d.State.CanTransitionTo(next) {
+		return &TransitionError{From: d.State, To: next}
+	}
+	if d.State == next {
+		return nil
+	}
+
+	d.recordTransition(next, reason)
+	return nil
+}
+
+// ForceTo moves the data to next state even if the transition table doesn't allow it, so that
+// operators can repair a day. The transition is recorded as an event with reason.
+func (d *Data) ForceTo(next DataState, reason string) {
+	d.recordTransition(next, reason)
+}
+
+func (d *Data) recordTransition(next DataState, reason string) {
+	event := &Event{
+		From:      d.State,
+		To:        next,
+		Timestamp: time.Now().UTC(),
+		Reason:    reason,
+	}
+	if d.AKSBuild != nil {
+		id := d.AKSBuild.ID
+		event.BuildID = &id
+	}
+	for _, r := range d.AKSRelease {
+		if r.ReleaseID != nil {
+			event.ReleaseIDs = append(event.ReleaseIDs, *r.ReleaseID)
+		}
+	}
+
+	d.Events = append(d.Events, event)
+	d.State = next
+}
+
+// StagingStatusFailed is recorded instead of `rejected` when the deployment of a staging failed
+// rather than being rejected by an approver, the other staging status values are the environment
+// status of azure devops releases
+const StagingStatusFailed = "failed"
+
+// StagingStatusTimedOut is recorded when the monitor abandoned the deployment of a staging which ran
+// longer than its timeout
+const StagingStatusTimedOut = "timedOut"
+
+// StagingStatusRetryPending is recorded when the monitor abandoned the deployment of a staging which
+// ran longer than its timeout and deploys it again
+const StagingStatusRetryPending = "retryPending"
+
+// ReleaseOutcome aggregates the status of all stagings into the state of the release phase, the
+// staging or the release creation which ends the release unsuccessfully is returned as failure.
+// ReleaseInProgress is returned while the outcome is not decided yet, i.e. while any staging is
+// running or any definition is still waiting for its release to be created.
+func ReleaseOutcome(releases []*AKSRelease) (DataState, *Failure) {
+	var (
+		running, pending, partially, creating bool
+		failure                               *Failure
+		outcome                               DataState
+	)
+
+	for _, r := range releases {
+		if r.ReleaseID == nil {
+			switch r.State {
+			case ReleaseStateValues.Blocked:
+			case ReleaseStateValues.Abandoned:
+				if failure == nil {
+					failure = &Failure{
+						Reason:       fmt.Sprintf("release of definition %d couldn't be created after %d attempts: %s", r.DefinitionID, r.Attempts, r.LastError),
+						DefinitionID: r.DefinitionID,
+					}
+					outcome = DataStateValues.ReleaseFailed
+				}
+			default:
+				creating = true
+			}
+			continue
+		}
+		for _, s := range r.Staging {
+			status := ""
+			if s.Status != nil {
+				status = *s.Status
+			}
+
+			switch status {
+			case "", "undefined", "notStarted":
+				pending = true
+			case "inProgress", "queued", "scheduled", StagingStatusRetryPending:
+				running = true
+			case "succeeded":
+			case "partiallySucceeded":
+				partially = true
+			case StagingStatusFailed, StagingStatusTimedOut, "rejected", "canceled":
+				if failure == nil {
+					failure = &Failure{
+						Reason:       fmt.Sprintf("staging %s of release definition %d is %s", s.Name, r.DefinitionID, status),
+						DefinitionID: r.DefinitionID,
+						ReleaseID:    r.ReleaseID,
+						Staging:      s.Name,
+						Status:       status,
+					}
+					outcome = releaseFailureStates[status]
+				}
+			default:
+				running = true
+			}
+		}
+	}
+
+	switch {
+	case running, creating:
+		// the outcome is only decided once every definition has a release
+		return DataStateValues.ReleaseInProgress, nil
+	case failure != nil:
+		// stagings which haven't started are blocked by the failed one
+		return outcome, failure
+	case pending:
+		return DataStateValues.ReleaseInProgress, nil
+	case partially:
+		return DataStateValues.ReleasePartiallySucceeded, nil
+	default:
+		return DataStateValues.ReleaseSucceeded, nil
+	}
+}
+
+var releaseFailureStates = map[string]DataState{
+	StagingStatusFailed:   DataStateValues.ReleaseFailed,
+	"rejected":            DataStateValues.ReleaseRejected,
+	"canceled":            DataStateValues.ReleaseCanceled,
+	StagingStatusTimedOut: DataStateValues.ReleaseTimedOut,
+}
+
+// UpdateState derives the state of a created release from its stagings
+func (r *AKSRelease) UpdateState() {
+	if r.ReleaseID == nil {
+		return
+	}
+	outcome, _ := ReleaseOutcome([]*AKSRelease{r})
+	r.State = releaseStates[outcome]
+}
+
+var releaseStates = map[DataState]ReleaseState{
+	DataStateValues.ReleaseInProgress:         ReleaseStateValues.InProgress,
+	DataStateValues.ReleaseSucceeded:          ReleaseStateValues.Succeeded,
+	DataStateValues.ReleasePartiallySucceeded: ReleaseStateValues.PartiallySucceeded,
+	DataStateValues.ReleaseFailed:             ReleaseStateValues.Failed,
+	DataStateValues.ReleaseRejected:           ReleaseStateValues.Rejected,
+	DataStateValues.ReleaseCanceled:           ReleaseStateValues.Canceled,
+	DataStateValues.ReleaseTimedOut:           ReleaseStateValues.TimedOut,
+}
+
+// IsUnsuccessful checks whether the release ended without succeeding or won't be created
+func (s ReleaseState) IsUnsuccessful() bool {
+	switch s {
+	case ReleaseStateValues.Abandoned,
+		ReleaseStateValues.Blocked,
+		ReleaseStateValues.Failed,
+		ReleaseStateValues.Rejected,
+		ReleaseStateValues.Canceled,
+		ReleaseStateValues.TimedOut:
+		return true
+	}
+	return false
+}
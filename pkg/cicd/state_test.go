@@ -0,0 +1,163 @@
+package cicd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransitionTo(t *testing.T) {
+	tests := []struct {
+		from    DataState
+		to      DataState
+		wantErr bool
+	}{
+		{DataStateValues.None, DataStateValues.NotStart, false},
+		{DataStateValues.None, DataStateValues.SkippedFreeze, false},
+		{DataStateValues.NotStart, DataStateValues.BuildInProgress, false},
+		{DataStateValues.BuildInProgress, DataStateValues.BuildFailed, false},
+		{DataStateValues.BuildFailed, DataStateValues.NotStart, false},
+		{DataStateValues.BuildFailed, DataStateValues.BuildAbandoned, false},
+		{DataStateValues.BuildSucceeded, DataStateValues.ReleaseInProgress, false},
+		{DataStateValues.BuildSucceeded, DataStateValues.SkippedFreeze, true},
+		{DataStateValues.ReleaseInProgress, DataStateValues.ReleaseTimedOut, false},
+		{DataStateValues.ReleaseInProgress, DataStateValues.ReleaseInProgress, false},
+		{DataStateValues.None, DataStateValues.ReleaseSucceeded, true},
+		{DataStateValues.BuildInProgress, DataStateValues.NotStart, true},
+		{DataStateValues.BuildAbandoned, DataStateValues.NotStart, true},
+		{DataStateValues.ReleaseSucceeded, DataStateValues.ReleaseInProgress, true},
+	}
+
+	for _, tt := range tests {
+		data := &Data{State: tt.from}
+		err := data.TransitionTo(tt.to, "test")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s -> %s: error = %v, wantErr %v", tt.from, tt.to, err, tt.wantErr)
+			continue
+		}
+
+		if tt.wantErr {
+			var transitionErr *TransitionError
+			if !errors.As(err, &transitionErr) {
+				t.Errorf("%s -> %s: error = %T, want *TransitionError", tt.from, tt.to, err)
+			}
+			if data.State != tt.from || len(data.Events) != 0 {
+				t.Errorf("%s -> %s: data changed by an illegal transition", tt.from, tt.to)
+			}
+			continue
+		}
+
+		if data.State != tt.to {
+			t.Errorf("%s -> %s: state = %s", tt.from, tt.to, data.State)
+		}
+		wantEvents := 1
+		if tt.from == tt.to {
+			wantEvents = 0
+		}
+		if len(data.Events) != wantEvents {
+			t.Errorf("%s -> %s: %d events recorded, want %d", tt.from, tt.to, len(data.Events), wantEvents)
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	for _, s := range dataStates {
+		_, ok := transitions[s]
+		if s.IsTerminal() == ok {
+			t.Errorf("%s.IsTerminal() = %v", s, s.IsTerminal())
+		}
+	}
+}
+
+func TestReleaseOutcome(t *testing.T) {
+	id := 1
+	staging := func(statuses ...string) []*Staging {
+		var result []*Staging
+		for i, s := range statuses {
+			status := s
+			result = append(result, &Staging{Name: string(rune('a' + i)), Status: &status})
+		}
+		return result
+	}
+	created := func(statuses ...string) *AKSRelease {
+		return &AKSRelease{DefinitionID: 10, ReleaseID: &id, Staging: staging(statuses...)}
+	}
+
+	tests := []struct {
+		name        string
+		releases    []*AKSRelease
+		want        DataState
+		wantFailure bool
+	}{
+		{
+			name:     "all succeeded",
+			releases: []*AKSRelease{created("succeeded", "succeeded")},
+			want:     DataStateValues.ReleaseSucceeded,
+		},
+		{
+			name:     "partially succeeded",
+			releases: []*AKSRelease{created("succeeded", "partiallySucceeded")},
+			want:     DataStateValues.ReleasePartiallySucceeded,
+		},
+		{
+			name:     "running",
+			releases: []*AKSRelease{created("succeeded", "inProgress")},
+			want:     DataStateValues.ReleaseInProgress,
+		},
+		{
+			name:     "not started",
+			releases: []*AKSRelease{created("succeeded", "notStarted")},
+			want:     DataStateValues.ReleaseInProgress,
+		},
+		{
+			name:        "failed blocks the stagings after it",
+			releases:    []*AKSRelease{created(StagingStatusFailed, "notStarted")},
+			want:        DataStateValues.ReleaseFailed,
+			wantFailure: true,
+		},
+		{
+			name:     "failed waits for running stagings",
+			releases: []*AKSRelease{created("rejected", "inProgress")},
+			want:     DataStateValues.ReleaseInProgress,
+		},
+		{
+			name:        "rejected",
+			releases:    []*AKSRelease{created("rejected")},
+			want:        DataStateValues.ReleaseRejected,
+			wantFailure: true,
+		},
+		{
+			name:        "timed out",
+			releases:    []*AKSRelease{created(StagingStatusTimedOut)},
+			want:        DataStateValues.ReleaseTimedOut,
+			wantFailure: true,
+		},
+		{
+			name:     "release being created",
+			releases: []*AKSRelease{created("succeeded"), {DefinitionID: 11, State: ReleaseStateValues.Pending}},
+			want:     DataStateValues.ReleaseInProgress,
+		},
+		{
+			name:        "release abandoned",
+			releases:    []*AKSRelease{created("succeeded"), {DefinitionID: 11, State: ReleaseStateValues.Abandoned, Attempts: 3}},
+			want:        DataStateValues.ReleaseFailed,
+			wantFailure: true,
+		},
+		{
+			name:     "blocked release is ignored",
+			releases: []*AKSRelease{created("succeeded"), {DefinitionID: 11, State: ReleaseStateValues.Blocked}},
+			want:     DataStateValues.ReleaseSucceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, failure := ReleaseOutcome(tt.releases)
+			if got != tt.want {
+				t.Errorf("ReleaseOutcome() = %s, want %s", got, tt.want)
+			}
+			if (failure != nil) != tt.wantFailure {
+				t.Errorf("ReleaseOutcome() failure = %+v, wantFailure %v", failure, tt.wantFailure)
+			}
+		})
+	}
+}
@@ -1,12 +1,35 @@
 package cicd
 
+import "time"
+
 // Data encapsulates the status information about whole CI/CD process
 type Data struct {
 	MasterValidation *MasterValidation `json:"e2e_master_validation,omitempty"`
 	AKSBuild         *AKSBuild         `json:"ev2_aks_build,omitempty"`
 	AKSRelease       []*AKSRelease     `json:"ev2_aks_release,omitempty"`
 	State            DataState         `json:"state"`
+	Failure          *Failure          `json:"failure,omitempty"`
 	Date             string            `json:"date"`
+	Events           []*Event          `json:"events,omitempty"`
+
+	// Paused stops the monitor from moving the day forward until it is resumed
+	Paused bool `json:"paused,omitempty"`
+
+	// Freeze records the freeze the day was skipped for
+	Freeze *Freeze `json:"freeze,omitempty"`
+
+	// CarriedOverTo is the latest day this unfinished day was carried over to
+	CarriedOverTo string `json:"carried_over_to,omitempty"`
+
+	// CarriedOverFrom are the earlier days which were unfinished when this day began
+	CarriedOverFrom []string `json:"carried_over_from,omitempty"`
+
+	// FreezeOverride lets the day start builds and releases during a freeze, for emergency releases
+	FreezeOverride bool `json:"freeze_override,omitempty"`
+
+	// Generation counts the times operators started the day over, builds and releases of an earlier
+	// generation are never adopted
+	Generation int `json:"generation,omitempty"`
 }
 
 // MasterValidation encapsulates the information about `E2Ev2 AKS RP Master Validation`
@@ -14,6 +37,24 @@ type MasterValidation struct {
 	ID       int     `json:"id"`
 	CommitID *string `json:"commit_id,omitempty"`
 	Branch   *string `json:"branch,omitempty"`
+
+	// BuildID, BuildNumber and FinishTime are of the validation build which validated the commit
+	BuildID     *int       `json:"build_id,omitempty"`
+	BuildNumber *string    `json:"build_number,omitempty"`
+	FinishTime  *time.Time `json:"finish_time,omitempty"`
+
+	// Validations are the builds of every validation pipeline which validated the commit
+	Validations []*Validation `json:"validations,omitempty"`
+}
+
+// Validation is a build of a validation pipeline which validated the commit
+type Validation struct {
+	PipelineID  int        `json:"pipeline_id"`
+	BuildID     int        `json:"build_id"`
+	BuildNumber *string    `json:"build_number,omitempty"`
+	Branch      *string    `json:"branch,omitempty"`
+	Result      *string    `json:"result,omitempty"`
+	FinishTime  *time.Time `json:"finish_time,omitempty"`
 }
 
 // AKSBuild encapsulates the information about `[EV2] AKS Build` runs
@@ -23,42 +64,213 @@ type AKSBuild struct {
 	BuildResult *string `json:"result,omitempty"`
 	BuildNumber *string `json:"build_number,omitempty"`
 	Count       int     `json:"count"`
+
+	QueueTime  *time.Time `json:"queue_time,omitempty"`
+	StartTime  *time.Time `json:"start_time,omitempty"`
+	FinishTime *time.Time `json:"finish_time,omitempty"`
+
+	// RetryAfter is the earliest time a failed build is queued again
+	RetryAfter *time.Time `json:"retry_after,omitempty"`
+
+	// TimedOut is set when the build was canceled for running longer than its timeout
+	TimedOut bool `json:"timed_out,omitempty"`
 }
 
 // AKSRelease encapsulates the information about `AKS Release` runs
 type AKSRelease struct {
+	Stage        string     `json:"stage,omitempty"`
 	DefinitionID int        `json:"definition_id"`
 	Alias        string     `json:"source_alias"`
 	ReleaseID    *int       `json:"release_id,omitempty"`
 	ReleaseName  *string    `json:"release_name,omitempty"`
 	Staging      []*Staging `json:"staging,omitempty"`
+	StartTime    *time.Time `json:"start_time,omitempty"`
+	FinishTime   *time.Time `json:"finish_time,omitempty"`
+
+	// State is the state of the release of the definition, Attempts counts the attempts to create it
+	State    ReleaseState `json:"state,omitempty"`
+	Attempts int          `json:"attempts,omitempty"`
+
+	// SoakUntil is when the release is created once its dependencies are done
+	SoakUntil *time.Time `json:"soak_until,omitempty"`
+
+	// LastError is the error of the latest failed attempt, RetryAfter the earliest time of the next one
+	LastError  string     `json:"last_error,omitempty"`
+	RetryAfter *time.Time `json:"retry_after,omitempty"`
 }
 
+// Staging encapsulates the information about an environment of `AKS Release` runs
 type Staging struct {
-	Name   string  `json:"staging_name"`
-	Status *string `json:"staging_status,omitempty"`
+	Stage      string     `json:"stage,omitempty"`
+	Name       string     `json:"staging_name"`
+	Status     *string    `json:"staging_status,omitempty"`
+	StartTime  *time.Time `json:"start_time,omitempty"`
+	FinishTime *time.Time `json:"finish_time,omitempty"`
+
+	// ApprovedBy and ApprovedAt record the latest pre-deployment approval of the staging
+	ApprovedBy string     `json:"approved_by,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+
+	// DeployRequestedAt is when the monitor started the deployment of the staging
+	DeployRequestedAt *time.Time `json:"deploy_requested_at,omitempty"`
+
+	// TimeoutRetries counts the deployments requested again after the staging timed out, RetryAfter
+	// is the earliest time of the next one and RetriedAt when the latest one was requested
+	TimeoutRetries int        `json:"timeout_retries,omitempty"`
+	RetryAfter     *time.Time `json:"retry_after,omitempty"`
+	RetriedAt      *time.Time `json:"retried_at,omitempty"`
+
+	// WaitingFor is what the running staging waits for, one of the StagingWaitingFor values
+	WaitingFor    string            `json:"waiting_for,omitempty"`
+	Interventions []*Intervention   `json:"interventions,omitempty"`
+	Gates         []*GateEvaluation `json:"gates,omitempty"`
 }
 
+// what a running staging waits for
+const (
+	StagingWaitingForApproval     = "approval"
+	StagingWaitingForIntervention = "manualIntervention"
+	StagingWaitingForGates        = "gates"
+)
+
+// Intervention is a manual intervention task of a staging
+type Intervention struct {
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	Status       string     `json:"status"`
+	Instructions string     `json:"instructions,omitempty"`
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+
+	// Deadline is when the monitor resumes or rejects the intervention according to its rules
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// ResolvedBy and Comment record who resumed or rejected the intervention and why
+	ResolvedBy string `json:"resolved_by,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+}
+
+// GateEvaluation is the evaluation of the pre or post-deployment gates of a staging
+type GateEvaluation struct {
+	ID              int        `json:"id"`
+	Phase           string     `json:"phase"`
+	Status          string     `json:"status"`
+	Gates           []string   `json:"gates,omitempty"`
+	IgnoredGates    []string   `json:"ignored_gates,omitempty"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	SucceedingSince *time.Time `json:"succeeding_since,omitempty"`
+
+	// Deadline is when the evaluation times out according to the gate options of the staging
+	Deadline *time.Time `json:"deadline,omitempty"`
+}
+
+// phases of a gate evaluation
+const (
+	GatePhasePreDeployment  = "preDeployment"
+	GatePhasePostDeployment = "postDeployment"
+)
+
+// Freeze records a freeze which prevented the day from starting a build or a release
+type Freeze struct {
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// Event records a transition of the data state
+type Event struct {
+	From       DataState `json:"from"`
+	To         DataState `json:"to"`
+	Timestamp  time.Time `json:"timestamp"`
+	Reason     string    `json:"reason,omitempty"`
+	BuildID    *int      `json:"build_id,omitempty"`
+	ReleaseIDs []int     `json:"release_ids,omitempty"`
+}
+
+// Failure records what caused the CI/CD process to end unsuccessfully
+type Failure struct {
+	Reason       string `json:"reason"`
+	DefinitionID int    `json:"definition_id,omitempty"`
+	ReleaseID    *int   `json:"release_id,omitempty"`
+	Staging      string `json:"staging_name,omitempty"`
+	Status       string `json:"staging_status,omitempty"`
+}
+
+// DataState is the state of the whole CI/CD process
 type DataState string
 
 type dataStateValuesType struct {
-	None              DataState
-	NotStart          DataState
-	BuildInProgress   DataState
-	BuildFailed       DataState
-	BuildSucceeded    DataState
-	ReleaseInProgress DataState
-	ReleaseFailed     DataState
-	ReleaseSucceeded  DataState
+	None                      DataState
+	NotStart                  DataState
+	BuildInProgress           DataState
+	BuildFailed               DataState
+	BuildAbandoned            DataState
+	BuildSucceeded            DataState
+	ReleaseInProgress         DataState
+	ReleaseFailed             DataState
+	ReleaseSucceeded          DataState
+	ReleasePartiallySucceeded DataState
+	ReleaseRejected           DataState
+	ReleaseCanceled           DataState
+	SkippedFreeze             DataState
+	NoChanges                 DataState
+	BuildTimedOut             DataState
+	ReleaseTimedOut           DataState
+	SkippedOverlap            DataState
 }
 
 var DataStateValues = dataStateValuesType{
-	None:              "none",
-	NotStart:          "notStart",
-	BuildInProgress:   "buildInProgress",
-	BuildFailed:       "buildFailed",
-	BuildSucceeded:    "buildSucceeded",
-	ReleaseInProgress: "releaseInProgress",
-	ReleaseFailed:     "releaseFailed",
-	ReleaseSucceeded:  "releaseSucceeded",
+	None:                      "none",
+	NotStart:                  "notStart",
+	BuildInProgress:           "buildInProgress",
+	BuildFailed:               "buildFailed",
+	BuildAbandoned:            "buildAbandoned",
+	BuildSucceeded:            "buildSucceeded",
+	ReleaseInProgress:         "releaseInProgress",
+	ReleaseFailed:             "releaseFailed",
+	ReleaseSucceeded:          "releaseSucceeded",
+	ReleasePartiallySucceeded: "releasePartiallySucceeded",
+	ReleaseRejected:           "releaseRejected",
+	ReleaseCanceled:           "releaseCanceled",
+	SkippedFreeze:             "skippedFreeze",
+	NoChanges:                 "noChanges",
+	BuildTimedOut:             "buildTimedOut",
+	ReleaseTimedOut:           "releaseTimedOut",
+	SkippedOverlap:            "skippedOverlap",
+}
+
+// ReleaseState is the state of the release of a definition
+type ReleaseState string
+
+type releaseStateValuesType struct {
+	Pending            ReleaseState
+	CreateFailed       ReleaseState
+	Abandoned          ReleaseState
+	Blocked            ReleaseState
+	Soaking            ReleaseState
+	InProgress         ReleaseState
+	Succeeded          ReleaseState
+	PartiallySucceeded ReleaseState
+	Failed             ReleaseState
+	Rejected           ReleaseState
+	Canceled           ReleaseState
+	TimedOut           ReleaseState
+}
+
+var ReleaseStateValues = releaseStateValuesType{
+	// Pending waits for the dependencies of the release
+	Pending: "pending",
+	// CreateFailed is retried after the creation of the release failed
+	CreateFailed: "createFailed",
+	// Abandoned gave up creating the release
+	Abandoned: "abandoned",
+	// Blocked won't be created as a dependency of the release ended unsuccessfully
+	Blocked: "blocked",
+	// Soaking waits for the soak time after the dependencies of the release are done
+	Soaking:            "soaking",
+	InProgress:         "inProgress",
+	Succeeded:          "succeeded",
+	PartiallySucceeded: "partiallySucceeded",
+	Failed:             "failed",
+	Rejected:           "rejected",
+	Canceled:           "canceled",
+	TimedOut:           "timedOut",
 }
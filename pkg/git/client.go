@@ -7,10 +7,12 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	vsts "github.com/microsoft/azure-devops-go-api/azuredevops"
 	vstsgit "github.com/microsoft/azure-devops-go-api/azuredevops/git"
 	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/metrics"
 	"github.com/yangzuo0621/monitor/pkg/vstspat"
 )
 
@@ -77,6 +79,7 @@ func (c *gitClient) PushNewGitBranch(ctx context.Context) (*vstsgit.GitRef, erro
 	branch := c.refsHeadBranch("zuya/test-branch")
 	master := c.refsHeadBranch("zuya/e2e-cluster-verify-handler")
 	isLocked := false
+	start := time.Now()
 	resp, err := client.UpdateRef(ctx, vstsgit.UpdateRefArgs{
 		NewRefInfo: &vstsgit.GitRefUpdate{
 			OldObjectId: &oldObjectID,
@@ -88,6 +91,7 @@ func (c *gitClient) PushNewGitBranch(ctx context.Context) (*vstsgit.GitRef, erro
 		Filter:       &master,
 		Project:      &c.project,
 	})
+	metrics.ObserveAPICall("git", "UpdateRef", start, err)
 
 	if err != nil {
 		err = fmt.Errorf("push get ref failed: %w", err)
@@ -109,10 +113,12 @@ func (c *gitClient) GetGitRepository(ctx context.Context) (*vstsgit.GitRepositor
 		return nil, err
 	}
 
+	start := time.Now()
 	repo, err := client.GetRepository(ctx, vstsgit.GetRepositoryArgs{
 		RepositoryId: &c.repositoryID,
 		Project:      &c.project,
 	})
+	metrics.ObserveAPICall("git", "GetRepository", start, err)
 
 	if err != nil {
 		return nil, err
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	apiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "monitor_azure_devops_requests_total",
+		Help: "Number of Azure DevOps API calls by client, operation and result.",
+	}, []string{"client", "operation", "result"})
+	apiRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "monitor_azure_devops_request_duration_seconds",
+		Help:    "Latency of Azure DevOps API calls by client and operation.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"client", "operation"})
+)
+
+// ObserveAPICall records an Azure DevOps API call of client started at start
+func ObserveAPICall(client string, operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	apiRequests.WithLabelValues(client, operation, result).Inc()
+	apiRequestDuration.WithLabelValues(client, operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,12 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Handler returns a HTTP handler serving the metrics of the default prometheus registry
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
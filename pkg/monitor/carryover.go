@@ -0,0 +1,177 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+const defaultCarryOverDays = 3
+
+// overlap policies decide whether the day starts while earlier days are unfinished
+const (
+	// OverlapQueue lets the day start once the earlier days are finished
+	OverlapQueue = "queue"
+	// OverlapBlock skips the day if it begins while earlier days are unfinished
+	OverlapBlock = "block"
+	// OverlapParallel lets the day start alongside the earlier days
+	OverlapParallel = "parallel"
+)
+
+// CarryOverConfig controls how the days unfinished at the end of their date are carried over
+type CarryOverConfig struct {
+	// Days is the number of earlier days searched for unfinished work, defaults to 3
+	Days int `json:"days,omitempty"`
+
+	// Overlap is the policy of the current day while earlier days are unfinished: queue, block or
+	// parallel, defaults to queue
+	Overlap string `json:"overlap,omitempty"`
+}
+
+// carryOverConfig returns the carry over config with defaults applied
+func (c *FlowConfig) carryOverConfig() CarryOverConfig {
+	config := CarryOverConfig{}
+	if c.CarryOver != nil {
+		config = *c.CarryOver
+	}
+
+	if config.Days <= 0 {
+		config.Days = defaultCarryOverDays
+	}
+	if config.Overlap == "" {
+		config.Overlap = OverlapQueue
+	}
+	return config
+}
+
+func (c *CarryOverConfig) validate() error {
+	switch c.Overlap {
+	case "", OverlapQueue, OverlapBlock, OverlapParallel:
+		return nil
+	}
+	return fmt.Errorf("unknown overlap policy %q", c.Overlap)
+}
+
+// reconcileCarriedOver reconciles the earlier days of today which started but aren't finished, or
+// which are queued behind unfinished days, from the oldest one. The days still unfinished
+// afterwards are returned.
+func (c *MonitorClient) reconcileCarriedOver(ctx context.Context, today string) ([]string, error) {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action": "reconcileCarriedOver",
+	})
+
+	day, err := c.schedule.startOfDay(today)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		unfinished []string
+		resultErr  error
+	)
+	for i := c.config.carryOverConfig().Days; i >= 1; i-- {
+		date := day.AddDate(0, 0, -i).Format(dateFormat)
+		data, err := c.reconcileEarlierDay(ctx, date, today, unfinished)
+		if err != nil {
+			logger.WithError(err).Error()
+			if resultErr == nil {
+				resultErr = err
+			}
+		}
+		if data != nil && !data.State.IsTerminal() {
+			unfinished = append(unfinished, date)
+		}
+	}
+	return unfinished, resultErr
+}
+
+// reconcileEarlierDay reconciles date if it started but isn't finished, nil is returned for the days
+// which have no data or haven't started. A day which waited for the days unfinished before it is
+// started once they are finished, it keeps the later days waiting until then.
+func (c *MonitorClient) reconcileEarlierDay(ctx context.Context, date string, today string, unfinished []string) (*cicd.Data, error) {
+	data, version, err := c.store.GetData(ctx, c.blobName(date))
+	if errors.Is(err, statestore.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		stateStoreFailures.WithLabelValues(c.flowName(), "read").Inc()
+		return nil, fmt.Errorf("get data of %s: %w", date, err)
+	}
+	if data.State.IsTerminal() {
+		return nil, nil
+	}
+	if data.State == cicd.DataStateValues.None {
+		queued, err := c.queued(data)
+		if err != nil || !queued {
+			return nil, err
+		}
+	}
+	c.flow.migrate(data)
+
+	base, err := copyData(data)
+	if err != nil {
+		return nil, err
+	}
+	if data.Paused {
+		return data, nil
+	}
+
+	c.logger.Infof("CI/CD of %s is unfinished in state %s, carried over to %s", date, data.State, today)
+	data.CarriedOverTo = today
+	var stepErr error
+	if c.applyOverlapPolicy(data, unfinished, c.logger) {
+		stepErr = c.step(ctx, data)
+	}
+
+	saved, err := c.persist(ctx, date, base, data, version)
+	if saved != nil {
+		data = saved
+	}
+	if stepErr != nil {
+		return data, stepErr
+	}
+	return data, err
+}
+
+// queued checks whether the day which hasn't started waits for earlier days, so that it's started
+// once they are finished. A day without a run scheduled never starts and isn't waiting.
+func (c *MonitorClient) queued(data *cicd.Data) (bool, error) {
+	if len(data.CarriedOverFrom) == 0 {
+		return false, nil
+	}
+	_, scheduled, err := c.schedule.startTime(data.Date)
+	if err != nil {
+		return false, fmt.Errorf("get start time of %s: %w", data.Date, err)
+	}
+	return scheduled, nil
+}
+
+// applyOverlapPolicy decides whether the current day may start while the earlier days unfinished
+// are running, the link between the days is recorded in data. false is returned if the step of the
+// day is skipped.
+func (c *MonitorClient) applyOverlapPolicy(data *cicd.Data, unfinished []string, logger logrus.FieldLogger) bool {
+	if data.State != cicd.DataStateValues.None || len(unfinished) == 0 {
+		return true
+	}
+	data.CarriedOverFrom = unfinished
+
+	switch c.config.carryOverConfig().Overlap {
+	case OverlapParallel:
+		return true
+	case OverlapBlock:
+		c.plan.add("skip %s for unfinished days %v", data.Date, unfinished)
+		reason := fmt.Sprintf("earlier days %v are unfinished", unfinished)
+		if err := data.TransitionTo(cicd.DataStateValues.SkippedOverlap, reason); err != nil {
+			logger.WithError(err).Error()
+		}
+		logger.Infof("%s is skipped, %s", data.Date, reason)
+		return false
+	default:
+		logger.Infof("%s waits for the unfinished days %v", data.Date, unfinished)
+		return false
+	}
+}
@@ -0,0 +1,206 @@
+package monitor
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+func TestApplyOverlapPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		overlap    string
+		state      cicd.DataState
+		unfinished []string
+		wantStep   bool
+		wantState  cicd.DataState
+		wantFrom   []string
+	}{
+		{
+			name:      "no unfinished days",
+			state:     cicd.DataStateValues.None,
+			wantStep:  true,
+			wantState: cicd.DataStateValues.None,
+		},
+		{
+			name:       "started day",
+			state:      cicd.DataStateValues.BuildInProgress,
+			unfinished: []string{"2020-06-30"},
+			wantStep:   true,
+			wantState:  cicd.DataStateValues.BuildInProgress,
+		},
+		{
+			name:       "queue",
+			state:      cicd.DataStateValues.None,
+			unfinished: []string{"2020-06-30"},
+			wantState:  cicd.DataStateValues.None,
+			wantFrom:   []string{"2020-06-30"},
+		},
+		{
+			name:       "block",
+			overlap:    OverlapBlock,
+			state:      cicd.DataStateValues.None,
+			unfinished: []string{"2020-06-29", "2020-06-30"},
+			wantState:  cicd.DataStateValues.SkippedOverlap,
+			wantFrom:   []string{"2020-06-29", "2020-06-30"},
+		},
+		{
+			name:       "parallel",
+			overlap:    OverlapParallel,
+			state:      cicd.DataStateValues.None,
+			unfinished: []string{"2020-06-30"},
+			wantStep:   true,
+			wantState:  cicd.DataStateValues.None,
+			wantFrom:   []string{"2020-06-30"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.CarryOver = &CarryOverConfig{Overlap: tt.overlap}
+			c, _, _ := newTestClient(t, config)
+			data := &cicd.Data{Date: "2020-07-01", State: tt.state}
+
+			if got := c.applyOverlapPolicy(data, tt.unfinished, c.logger); got != tt.wantStep {
+				t.Errorf("applyOverlapPolicy() = %v, want %v", got, tt.wantStep)
+			}
+			if data.State != tt.wantState {
+				t.Errorf("state = %s, want %s", data.State, tt.wantState)
+			}
+			if strings.Join(data.CarriedOverFrom, ",") != strings.Join(tt.wantFrom, ",") {
+				t.Errorf("carried over from = %v, want %v", data.CarriedOverFrom, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestReconcileCarriedOver(t *testing.T) {
+	// each earlier day is given by the number of days before today
+	tests := []struct {
+		name           string
+		trigger        string
+		days           map[int]*cicd.Data
+		wantUnfinished []int
+		wantStates     map[int]cicd.DataState
+		wantQueued     int
+	}{
+		{
+			name: "no earlier days",
+		},
+		{
+			name: "finished and never started days",
+			days: map[int]*cicd.Data{
+				1: {State: cicd.DataStateValues.ReleaseSucceeded},
+				2: {State: cicd.DataStateValues.None},
+			},
+		},
+		{
+			name: "unfinished day is carried over",
+			days: map[int]*cicd.Data{
+				1: {State: cicd.DataStateValues.BuildInProgress, AKSBuild: &cicd.AKSBuild{ID: 100, Count: 1}},
+			},
+			wantUnfinished: []int{1},
+			wantStates:     map[int]cicd.DataState{1: cicd.DataStateValues.BuildInProgress},
+		},
+		{
+			name: "queued day waits for the unfinished days before it",
+			days: map[int]*cicd.Data{
+				2: {State: cicd.DataStateValues.BuildInProgress, AKSBuild: &cicd.AKSBuild{ID: 100, Count: 1}},
+				1: {State: cicd.DataStateValues.None, CarriedOverFrom: []string{"earlier"}},
+			},
+			wantUnfinished: []int{2, 1},
+			wantStates: map[int]cicd.DataState{
+				2: cicd.DataStateValues.BuildInProgress,
+				1: cicd.DataStateValues.None,
+			},
+		},
+		{
+			name: "queued day starts once the days before it finished",
+			days: map[int]*cicd.Data{
+				2: {State: cicd.DataStateValues.ReleaseSucceeded},
+				1: {State: cicd.DataStateValues.None, CarriedOverFrom: []string{"earlier"}},
+			},
+			wantUnfinished: []int{1},
+			wantStates:     map[int]cicd.DataState{1: cicd.DataStateValues.NotStart},
+			wantQueued:     1,
+		},
+		{
+			name:    "queued day without a scheduled run is dropped",
+			trigger: "0 0 31 2 *",
+			days: map[int]*cicd.Data{
+				1: {State: cicd.DataStateValues.None, CarriedOverFrom: []string{"earlier"}},
+			},
+			wantStates: map[int]cicd.DataState{1: cicd.DataStateValues.None},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			if tt.trigger != "" {
+				config.Schedule = &ScheduleConfig{Trigger: tt.trigger}
+			}
+			c, pipelineClient, _ := newTestClient(t, config)
+			ctx := context.Background()
+			today := c.Today()
+			pipelineClient.queue(2, "abc123", nil) // build 100 of the days in progress
+			pipelineClient.validate(1, "abc123")
+			pipelineClient.queued = nil
+
+			day, err := c.schedule.startOfDay(today)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dateOf := func(days int) string {
+				return day.AddDate(0, 0, -days).Format(dateFormat)
+			}
+			for days, d := range tt.days {
+				data := c.flow.newData(dateOf(days))
+				data.State, data.AKSBuild, data.CarriedOverFrom = d.State, d.AKSBuild, d.CarriedOverFrom
+				if _, err := c.UploadDataToBlob(ctx, data.Date, data, statestore.VersionAny); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			unfinished, err := c.reconcileCarriedOver(ctx, today)
+			if err != nil {
+				t.Fatalf("reconcileCarriedOver() error = %v", err)
+			}
+			var want []string
+			for _, days := range tt.wantUnfinished {
+				want = append(want, dateOf(days))
+			}
+			if strings.Join(unfinished, ",") != strings.Join(want, ",") {
+				t.Errorf("reconcileCarriedOver() = %v, want %v", unfinished, want)
+			}
+			for days, state := range tt.wantStates {
+				data, _, err := c.store.GetData(ctx, c.blobName(dateOf(days)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if data.State != state {
+					t.Errorf("state of %s = %s, want %s", data.Date, data.State, state)
+				}
+				if carried := data.CarriedOverTo == today; carried != containsInt(tt.wantUnfinished, days) {
+					t.Errorf("%s carried over to %q", data.Date, data.CarriedOverTo)
+				}
+			}
+			if len(pipelineClient.queued) != tt.wantQueued {
+				t.Errorf("queued %d builds, want %d", len(pipelineClient.queued), tt.wantQueued)
+			}
+		})
+	}
+}
+
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
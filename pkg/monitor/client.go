@@ -3,30 +3,56 @@ package monitor
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	vsts "github.com/microsoft/azure-devops-go-api/azuredevops"
 	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
 	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/calendar"
 	"github.com/yangzuo0621/monitor/pkg/cicd"
 	"github.com/yangzuo0621/monitor/pkg/pipelines"
 	"github.com/yangzuo0621/monitor/pkg/releases"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
 	"github.com/yangzuo0621/monitor/pkg/storageaccountv2"
 	"github.com/yangzuo0621/monitor/pkg/vstspat"
 )
 
 const (
 	personalAccessTokenKey = "PERSONAL_ACCESS_TOKEN"
-	monitorTimeInterval    = 5
+
+	// dateFormat is the format of the date each day of data is stored under
+	dateFormat = "2006-01-02"
 )
 
-// MonitorClient encapsulates the data client needs
+// MonitorClient encapsulates the data client needs to monitor one flow
 type MonitorClient struct {
-	storageAccessKey    string
 	personalAccessToken string
-	config              *Config
+	config              *FlowConfig
+	supervisor          SupervisorConfig
+	store               statestore.StateStore
+	flow                *flow
+	schedule            *schedule
+	freeze              *calendar.Calendar
+	status              *loopStatus
+
+	// plan is only set in a dry run, the mutating calls are recorded in it instead of being made
+	plan *plan
+
+	// newPipelineClient and newReleaseClient create the azure devops clients of the flow
+	newPipelineClient func(logger logrus.FieldLogger) (pipelines.PipelineClient, error)
+	newReleaseClient  func(logger logrus.FieldLogger) (releases.ReleaseClient, error)
+
+	// state observed by the previous cycle, used to account the time spent in each state
+	stateObserved   cicd.DataState
+	stateObservedAt time.Time
+
+	// series are the gauge series set by the latest cycle
+	series gaugeSeries
 
 	logger logrus.FieldLogger
 }
@@ -37,211 +63,420 @@ type ReleaseMetadata struct {
 	Stagings []string
 }
 
-type Config struct {
-	Organization          string     `json:"organization"`
-	Project               string     `json:"project"`
-	MasterValidationE2EID int        `json:"master_validation_e2e_id"`
-	AksBuildID            int        `json:"aks_build_id"`
-	AksRelease            []*Release `json:"aks_release"`
-	AzureStorageAccount   string     `json:"azure_storage_account"`
-	AzureStorageContainer string     `json:"azure_storage_container"`
-}
-
-type Release struct {
-	DefinitionID int      `json:"definition_id"`
-	Alias        string   `json:"source_alias"`
-	Stagings     []string `json:"staging"`
-}
-
-// BuildClient creates an instance of MonitorClient
+// BuildClient creates an instance of MonitorClient for the flow described by config
 func BuildClient(
-	storageAccessKey string,
 	personalAccessToken string,
-	config *Config,
+	config *FlowConfig,
+	supervisor SupervisorConfig,
+	store statestore.StateStore,
 	rootLogger logrus.FieldLogger,
-) *MonitorClient {
+) (*MonitorClient, error) {
 	logger := rootLogger.WithFields(logrus.Fields{
+		"flow":         config.name(),
 		"organization": config.Organization,
 		"project":      config.Project,
 	})
+
+	flow, err := buildFlow(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flow: %w", err)
+	}
+
+	schedule, err := buildSchedule(config.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule: %w", err)
+	}
+
+	if config.Deployment != nil {
+		if err := config.Deployment.validate(); err != nil {
+			return nil, fmt.Errorf("invalid deployment: %w", err)
+		}
+	}
+	if config.CarryOver != nil {
+		if err := config.CarryOver.validate(); err != nil {
+			return nil, fmt.Errorf("invalid carry over: %w", err)
+		}
+	}
+
+	freeze, err := buildFreezeCalendar(config.Freeze, schedule.location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid freeze: %w", err)
+	}
+
 	return &MonitorClient{
-		storageAccessKey:    storageAccessKey,
 		personalAccessToken: personalAccessToken,
 		config:              config,
-		logger:              logger,
+		supervisor:          supervisor,
+		store:               store,
+		flow:                flow,
+		schedule:            schedule,
+		freeze:              freeze,
+		status:              &loopStatus{},
+		series:              gaugeSeries{},
+		newPipelineClient: func(logger logrus.FieldLogger) (pipelines.PipelineClient, error) {
+			return pipelines.BuildPipelineClient(logger, vstspat.NewPATEnvBackend(personalAccessTokenKey), config.Organization, config.Project)
+		},
+		newReleaseClient: func(logger logrus.FieldLogger) (releases.ReleaseClient, error) {
+			return releases.BuildReleaseClient(logger, vstspat.NewPATEnvBackend(personalAccessTokenKey), config.Organization, config.Project)
+		},
+		logger: logger,
+	}, nil
+}
+
+func buildStateStore(storageAccessKey string, config *Config, logger logrus.FieldLogger) (statestore.StateStore, error) {
+	storeType := statestore.TypeBlob
+	if config.StateStore != nil && config.StateStore.Type != "" {
+		storeType = config.StateStore.Type
+	}
+
+	switch storeType {
+	case statestore.TypeBlob:
+		if storageAccessKey == "" {
+			return nil, fmt.Errorf("storage access key is required by %s state store", storeType)
+		}
+		blobClient := storageaccountv2.BuildBlobClient(config.AzureStorageAccount, config.AzureStorageContainer, storageAccessKey, logger)
+		return statestore.BuildBlobStateStore(blobClient, logger), nil
+	case statestore.TypeFile:
+		return statestore.BuildFileStateStore(config.StateStore.Directory, logger)
+	case statestore.TypeMemory:
+		return statestore.BuildMemoryStateStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown state store type %q", storeType)
 	}
 }
 
-// MonitorRoutine monitors the status of CI/CD every 5 minutes
-func (c *MonitorClient) MonitorRoutine() {
+// Reconcile runs one cycle of monitoring: it loads the data of the day, moves the CI/CD process
+// forward and persists the data, the error of any step is returned
+func (c *MonitorClient) Reconcile(ctx context.Context) error {
+	_, err := c.reconcile(ctx)
+	return err
+}
+
+// reconcile runs one cycle of monitoring and returns the resulting data of the day. The earlier
+// days which are still unfinished are carried over and reconciled first.
+func (c *MonitorClient) reconcile(ctx context.Context) (*cicd.Data, error) {
 	logger := c.logger.WithFields(logrus.Fields{
-		"action": "MonitorRoutine",
+		"action": "Reconcile",
 	})
 
-	for true {
-		select {
-		case <-time.After(monitorTimeInterval * time.Minute):
-			now := time.Now().UTC()
-			date := now.Format("2006-01-02")
-			logger.Infoln("date=", date)
-			ctx := context.Background()
-			data, err := c.GetDataFromBlob(ctx, date)
-			if err != nil {
-				logger.Errorln(err)
-				return
-			}
-			logger.Infof("%v", data)
-
-			switch data.State {
-			case cicd.DataStateValues.None:
-				c.TriggerAKSBuild(ctx, data)
-			case cicd.DataStateValues.NotStart, cicd.DataStateValues.BuildInProgress:
-				c.MonitorAKSBuild(ctx, data)
-			case cicd.DataStateValues.BuildFailed:
-				c.TriggerAKSBuild(ctx, data)
-			case cicd.DataStateValues.BuildSucceeded:
-				c.TriggerRelease(ctx, data)
-			case cicd.DataStateValues.ReleaseInProgress:
-				c.MonitorRelease(ctx, data)
-			default:
-				logger.Infoln("default")
-			}
+	now := time.Now().UTC()
+	date := c.Today()
+	logger.Infoln("date=", date)
+	unfinished, carryErr := c.reconcileCarriedOver(ctx, date)
 
-			err = c.UploadDataToBlob(ctx, date, data)
-			if err != nil {
-				logger.Errorln(err)
-			}
+	data, version, err := c.GetDataFromBlob(ctx, date)
+	var base *cicd.Data
+	if err == nil {
+		// base is kept to merge the changes of the cycle with concurrent modifications of the data
+		base, err = copyData(data)
+	}
+	if err != nil {
+		err = fmt.Errorf("get data of %s: %w", date, err)
+		c.status.finishCycle(now, carryErr, err)
+		c.recordCycleMetrics(nil, err)
+		return nil, err
+	}
+	logger.Infof("%v", data)
+
+	if data.Paused {
+		logger.Infof("CI/CD of %s is paused", date)
+		c.status.finishCycle(now, carryErr)
+		c.recordCycleMetrics(data, carryErr)
+		return data, carryErr
+	}
+
+	if c.applyOverlapPolicy(data, unfinished, logger) {
+		err = c.step(ctx, data)
+	}
+
+	saved, uploadErr := c.persist(ctx, date, base, data, version)
+	if saved != nil {
+		data = saved
+	}
+	c.status.finishCycle(now, carryErr, err, uploadErr)
+	for _, e := range []error{uploadErr, carryErr} {
+		if e == nil {
+			continue
+		}
+		if err == nil {
+			err = e
+		} else {
+			logger.WithError(e).Error()
 		}
 	}
+	c.recordCycleMetrics(data, err)
+	return data, err
 }
 
-// GetDataFromBlob retrives data from azure storage account blob
-func (c *MonitorClient) GetDataFromBlob(ctx context.Context, blobName string) (*cicd.Data, error) {
+// step moves the CI/CD process of data forward according to its state
+func (c *MonitorClient) step(ctx context.Context, data *cicd.Data) error {
 	logger := c.logger.WithFields(logrus.Fields{
-		"action": "getDataFromBlob",
-		"blob":   blobName,
+		"action": "step",
+		"date":   data.Date,
 	})
 
-	blobClient := storageaccountv2.BuildBlobClient(c.config.AzureStorageAccount, c.config.AzureStorageContainer, c.storageAccessKey, logger)
-	exist := blobClient.BlobExists(ctx, blobName)
-
-	var data cicd.Data
-	if exist {
-		blob, err := blobClient.GetBlob(ctx, blobName)
-		if err != nil {
-			logger.WithError(err).Error()
-			return nil, err
-		}
-		err = json.Unmarshal(blob, &data)
-		if err != nil {
-			logger.WithError(err).Error()
-			return nil, err
-		}
-	} else {
-		length := len(c.config.AksRelease)
-		aksReleases := make([]*cicd.AKSRelease, length)
-
-		for i := 0; i < length; i++ {
-			ss := c.config.AksRelease[i].Stagings
-			stagings := make([]*cicd.Staging, len(ss))
-			for j := 0; j < len(ss); j++ {
-				stagings[j] = &cicd.Staging{
-					Name: ss[j],
-				}
-			}
-			aksReleases[i] = &cicd.AKSRelease{
-				DefinitionID: c.config.AksRelease[i].DefinitionID,
-				Alias:        c.config.AksRelease[i].Alias,
-				Staging:      stagings,
-			}
-		}
+	var err error
+	switch data.State {
+	case cicd.DataStateValues.None:
+		err = c.TriggerAKSBuild(ctx, data)
+	case cicd.DataStateValues.NotStart, cicd.DataStateValues.BuildInProgress:
+		err = c.MonitorAKSBuild(ctx, data)
+	case cicd.DataStateValues.BuildFailed:
+		err = c.RetryAKSBuild(ctx, data)
+	case cicd.DataStateValues.BuildSucceeded:
+		err = c.TriggerRelease(ctx, data)
+	case cicd.DataStateValues.ReleaseInProgress:
+		err = c.MonitorRelease(ctx, data)
+	default:
+		logger.Infof("CI/CD of %s is finished with state %s", data.Date, data.State)
+	}
+	if err != nil {
+		err = fmt.Errorf("reconcile %s in state %s: %w", data.Date, data.State, err)
+		logger.WithError(err).Error()
+	}
+	return err
+}
 
-		data = cicd.Data{
-			MasterValidation: &cicd.MasterValidation{
-				ID: c.config.MasterValidationE2EID,
-			},
-			State:      cicd.DataStateValues.None,
-			AKSRelease: aksReleases,
-			Date:       blobName,
-		}
+// persist saves data of date, it is persisted even if the step failed or was interrupted, so that
+// anything already queued is recorded
+func (c *MonitorClient) persist(ctx context.Context, date string, base *cicd.Data, data *cicd.Data, version string) (*cicd.Data, error) {
+	persistCtx, cancel, err := persistContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("skip uploading data of %s: %w", date, err)
+	}
+	defer cancel()
+	saved, err := c.saveData(persistCtx, date, base, data, version)
+	if err != nil {
+		err = fmt.Errorf("upload data of %s: %w", date, err)
 	}
+	return saved, err
+}
 
-	return &data, nil
+// Today returns the business day the monitor is working on
+func (c *MonitorClient) Today() string {
+	return c.schedule.date(time.Now())
 }
 
-// UploadDataToBlob update data to azure storage account blob
-func (c *MonitorClient) UploadDataToBlob(ctx context.Context, blobName string, data *cicd.Data) error {
+// GetDataFromBlob retrives data of date and its version from the state store, a fresh record is
+// created if the day has no data yet
+func (c *MonitorClient) GetDataFromBlob(ctx context.Context, date string) (*cicd.Data, string, error) {
+	blobName := c.blobName(date)
 	logger := c.logger.WithFields(logrus.Fields{
-		"action": "UploadDataToBlob",
+		"action": "getDataFromBlob",
 		"blob":   blobName,
 	})
 
-	blobClient := storageaccountv2.BuildBlobClient(c.config.AzureStorageAccount, c.config.AzureStorageContainer, c.storageAccessKey, logger)
-	content, err := json.MarshalIndent(data, "", " ")
-	if err != nil {
+	data, version, err := c.store.GetData(ctx, blobName)
+	if err == nil {
+		c.flow.migrate(data)
+		return data, version, nil
+	}
+	if !errors.Is(err, statestore.ErrNotFound) {
+		stateStoreFailures.WithLabelValues(c.flowName(), "read").Inc()
 		logger.WithError(err).Error()
-		return err
+		return nil, statestore.VersionNone, err
 	}
 
-	_, err = blobClient.UploadBlob(ctx, blobName, content)
+	return c.flow.newData(date), statestore.VersionNone, nil
+}
+
+// blobName returns the name of the blob holding the data of date
+func (c *MonitorClient) blobName(date string) string {
+	return *c.config.BlobPrefix + date
+}
+
+// UploadDataToBlob update data of date to the state store if it is still at version, returns
+// statestore.ErrConflict otherwise
+func (c *MonitorClient) UploadDataToBlob(ctx context.Context, date string, data *cicd.Data, version string) (string, error) {
+	blobName := c.blobName(date)
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":  "UploadDataToBlob",
+		"blob":    blobName,
+		"version": version,
+	})
+
+	version, err := c.store.PutData(ctx, blobName, data, version)
+	if errors.Is(err, statestore.ErrConflict) {
+		logger.Warnln("data was modified concurrently")
+		return version, err
+	}
 	if err != nil {
+		stateStoreFailures.WithLabelValues(c.flowName(), "write").Inc()
 		logger.WithError(err).Error()
 	}
-	return err
+	return version, err
 }
 
-// TriggerAKSBuild triggers [EV2] AKS Build
+// TriggerAKSBuild runs the build stages of the flow: it picks the newest validated build and
+// triggers [EV2] AKS Build for its commit
 func (c *MonitorClient) TriggerAKSBuild(ctx context.Context, data *cicd.Data) error {
 	logger := c.logger.WithFields(logrus.Fields{
 		"action": "TriggerAKSBuild",
 	})
 
-	pipelineClient, err := pipelines.BuildPipelineClient(logger, vstspat.NewPATEnvBackend(personalAccessTokenKey), c.config.Organization, c.config.Project)
+	pipelineClient, err := c.pipelineClient(logger)
 	if err != nil {
 		logger.WithError(err).Error()
 		return err
 	}
 
-	builds, err := pipelineClient.ListPipelineBuilds(ctx, c.config.MasterValidationE2EID)
-	if len(builds) > 0 {
-		build := builds[0]
-		logger.Infoln("================== Build ==================")
-		bs, _ := json.MarshalIndent(build, "", " ")
-		logger.Infoln(string(bs))
-		variables := make(map[string]string)
-		result, err := pipelineClient.QueueBuildByCommit(ctx, c.config.AksBuildID, *build.SourceVersion, variables)
+	now := time.Now()
+	start, scheduled, err := c.schedule.startTime(data.Date)
+	if err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+	if !scheduled {
+		logger.Infof("no run is scheduled on %s", data.Date)
+		return nil
+	}
+	if now.Before(start) {
+		logger.Infof("run of %s starts at %s", data.Date, start.Format(time.RFC3339))
+		return nil
+	}
+	if skipped, err := c.skipForFreeze(data, now, logger); err != nil || skipped {
 		if err != nil {
-			logger.Errorln(err)
+			logger.WithError(err).Error()
+		}
+		return err
+	}
+
+	var commit string
+	if pick := c.flow.pickBuild; pick != nil {
+		minTime, maxTime, err := c.schedule.pickWindow(data.Date, now)
+		if err != nil {
+			logger.WithError(err).Error()
 			return err
 		}
+		gates := pick.gates()
+		picked, validations, err := c.pickCommit(ctx, pipelineClient, gates, minTime, maxTime, logger)
+		if err != nil {
+			logger.WithError(err).Error()
+			return err
+		}
+		if picked == "" {
+			logger.Infoln("no commit passed all validation gates yet")
+			return nil
+		}
 
-		logger.Infoln("================== Result ==================")
-		bs, _ = json.MarshalIndent(result, "", " ")
-		logger.Infoln(string(bs))
+		for i, b := range validations {
+			c.plan.add("pick build %d (%s) of pipeline %d validating commit %s", *b.Id, stringValue(b.BuildNumber), gates[i].PipelineID, picked)
+			logger.Infoln("================== Build ==================")
+			bs, _ := json.MarshalIndent(b, "", " ")
+			logger.Infoln(string(bs))
+		}
 
-		// "vstfs:///Build/Build/34898972"
-		ss := strings.Split(*result.Uri, "/")
-		id := ss[len(ss)-1]
-		i, _ := strconv.ParseInt(id, 10, 64)
+		recordValidations(data, gates, validations)
+		commit = picked
 
-		data.MasterValidation.Branch = build.SourceBranch
-		data.MasterValidation.CommitID = build.SourceVersion
+		released, releasedOn, err := c.releasedCommit(ctx, data.Date)
+		if err != nil {
+			logger.WithError(err).Error()
+			return err
+		}
+		if released == commit {
+			c.plan.add("end %s without changes, commit %s was released on %s", data.Date, commit, releasedOn)
+			reason := fmt.Sprintf("commit %s was already released on %s", commit, releasedOn)
+			if err := data.TransitionTo(cicd.DataStateValues.NoChanges, reason); err != nil {
+				logger.WithError(err).Error()
+				return err
+			}
+			logger.Infoln(reason)
+			return nil
+		}
+	}
+
+	if c.flow.queueBuild == nil {
+		// the picked build is released as it is
+		reason := fmt.Sprintf("picked build %d of commit %s", *data.MasterValidation.BuildID, commit)
+		if err := data.TransitionTo(cicd.DataStateValues.BuildSucceeded, reason); err != nil {
+			logger.WithError(err).Error()
+			return err
+		}
+		return nil
+	}
+
+	return c.queueAKSBuild(ctx, pipelineClient, data, commit, logger)
+}
 
-		if data.AKSBuild != nil {
-			data.AKSBuild.ID = int(i)
-			data.AKSBuild.Count = data.AKSBuild.Count + 1
-			data.AKSBuild.BuildNumber = result.BuildNumber
-			data.AKSBuild.BuildResult = nil
-			data.AKSBuild.BuildStatus = nil
+// queueAKSBuild queues the next attempt of [EV2] AKS Build for commit, or for the branch of the
+// QueueBuild stage, unless a previous cycle already queued it
+func (c *MonitorClient) queueAKSBuild(ctx context.Context, pipelineClient pipelines.PipelineClient, data *cicd.Data, commit string, logger logrus.FieldLogger) error {
+	queue := c.flow.queueBuild
+	attempt := 1
+	if data.AKSBuild != nil {
+		attempt = data.AKSBuild.Count + 1
+	}
+	tag := c.buildCorrelationID(data, attempt)
+
+	// a previous cycle may have queued the build and crashed before persisting it
+	queued := "queued"
+	result, err := c.findCorrelatedBuild(ctx, pipelineClient, queue.PipelineID, tag, data.Date)
+	if err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+	if result != nil {
+		queued = "adopted"
+		c.plan.add("adopt build %d tagged %s", *result.Id, tag)
+		logger.Infof("adopted build %d tagged %s", *result.Id, tag)
+	} else {
+		variables := make(map[string]string)
+		tags := []string{tag}
+		if queue.Commit != "" {
+			result, err = pipelineClient.QueueBuildByCommit(ctx, queue.PipelineID, commit, variables, tags)
 		} else {
-			data.AKSBuild = &cicd.AKSBuild{
-				ID:          int(i),
-				BuildNumber: result.BuildNumber,
-				Count:       1,
+			result, err = pipelineClient.QueueBuildByBranch(ctx, queue.PipelineID, queue.Branch, variables, tags)
+		}
+		if err != nil {
+			logger.Errorln(err)
+			return err
+		}
+
+		// tags of the queue request aren't always kept, the build is tagged again to be found later
+		if result.Id != nil {
+			if err := pipelineClient.AddBuildTags(ctx, *result.Id, tags); err != nil {
+				logger.WithError(err).Warnf("build %d may be queued again if this cycle isn't persisted", *result.Id)
 			}
 		}
+	}
+
+	logger.Infoln("================== Result ==================")
+	bs, _ := json.MarshalIndent(result, "", " ")
+	logger.Infoln(string(bs))
+
+	// "vstfs:///Build/Build/34898972"
+	ss := strings.Split(*result.Uri, "/")
+	id := ss[len(ss)-1]
+	i, _ := strconv.ParseInt(id, 10, 64)
+
+	if data.AKSBuild != nil {
+		data.AKSBuild.ID = int(i)
+		data.AKSBuild.Count = data.AKSBuild.Count + 1
+		data.AKSBuild.BuildNumber = result.BuildNumber
+		data.AKSBuild.BuildResult = nil
+		data.AKSBuild.BuildStatus = nil
+		data.AKSBuild.RetryAfter = nil
+		data.AKSBuild.TimedOut = false
+		data.AKSBuild.QueueTime = timeOf(result.QueueTime)
+		data.AKSBuild.StartTime = nil
+		data.AKSBuild.FinishTime = nil
+	} else {
+		data.AKSBuild = &cicd.AKSBuild{
+			ID:          int(i),
+			BuildNumber: result.BuildNumber,
+			Count:       1,
+			QueueTime:   timeOf(result.QueueTime),
+		}
+	}
 
-		data.State = cicd.DataStateValues.NotStart
+	reason := fmt.Sprintf("%s build %d of branch %s", queued, i, queue.Branch)
+	if queue.Commit != "" {
+		reason = fmt.Sprintf("%s build %d of commit %s", queued, i, commit)
+	}
+	if err := data.TransitionTo(cicd.DataStateValues.NotStart, reason); err != nil {
+		logger.WithError(err).Error()
+		return err
 	}
 	return nil
 }
@@ -252,7 +487,7 @@ func (c *MonitorClient) MonitorAKSBuild(ctx context.Context, data *cicd.Data) er
 		"action": "MonitorAKSBuild",
 	})
 
-	pipelineClient, err := pipelines.BuildPipelineClient(logger, vstspat.NewPATEnvBackend(personalAccessTokenKey), c.config.Organization, c.config.Project)
+	pipelineClient, err := c.pipelineClient(logger)
 	if err != nil {
 		logger.WithError(err).Error()
 		return err
@@ -264,58 +499,184 @@ func (c *MonitorClient) MonitorAKSBuild(ctx context.Context, data *cicd.Data) er
 		return err
 	}
 
+	if timedOut, err := c.timeoutAKSBuild(ctx, pipelineClient, data, build, logger); err != nil || timedOut {
+		if err != nil {
+			logger.WithError(err).Error()
+		}
+		return err
+	}
+
 	status := string(*build.Status)
 
+	next := cicd.DataStateValues.BuildInProgress
+	reason := fmt.Sprintf("build %d is %s", data.AKSBuild.ID, status)
 	if *build.Status == vstsbuild.BuildStatusValues.Completed {
 		if *build.Result == vstsbuild.BuildResultValues.Succeeded {
-			data.State = cicd.DataStateValues.BuildSucceeded
+			next = cicd.DataStateValues.BuildSucceeded
 		} else {
-			data.State = cicd.DataStateValues.BuildFailed
+			next = cicd.DataStateValues.BuildFailed
 		}
 		result := string(*build.Result)
 		data.AKSBuild.BuildResult = &result
-	} else {
-		data.State = cicd.DataStateValues.BuildInProgress
+		reason = fmt.Sprintf("build %d completed with result %s", data.AKSBuild.ID, result)
 	}
 	data.AKSBuild.BuildStatus = &status
+	data.AKSBuild.StartTime = timeOf(build.StartTime)
+	data.AKSBuild.FinishTime = timeOf(build.FinishTime)
+
+	if err := data.TransitionTo(next, reason); err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
 	return nil
 }
 
-// TriggerRelease triggers a release
+// TriggerRelease creates the releases whose stages have no pending dependencies
 func (c *MonitorClient) TriggerRelease(ctx context.Context, data *cicd.Data) error {
 	logger := c.logger.WithFields(logrus.Fields{
 		"action": "TriggerRelease",
 	})
 
-	releaseClient, err := releases.BuildReleaseClient(logger, vstspat.NewPATEnvBackend(personalAccessTokenKey), c.config.Organization, c.config.Project)
+	releaseClient, err := c.releaseClient(logger)
 	if err != nil {
 		logger.WithError(err).Error()
 		return err
 	}
 
+	// the day can't be skipped once its build succeeded, createReleases holds the releases during a freeze
+	resultErr := c.createReleases(ctx, releaseClient, data)
+	if !releasesStarted(data) {
+		// the creation is retried until a release exists, the day stays in BuildSucceeded meanwhile
+		return resultErr
+	}
+
+	buildID, _ := c.artifactOf(data, c.flow.buildStage().Name)
+	reason := fmt.Sprintf("created releases of build %d", buildID)
+	if err := data.TransitionTo(cicd.DataStateValues.ReleaseInProgress, reason); err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+	return resultErr
+}
+
+// createReleases creates a release for every CreateRelease stage whose dependencies are done,
+// stages are visited in topological order so releases unblocked by each other are created together.
+// A failed creation is retried on a later cycle according to the release retry policy.
+func (c *MonitorClient) createReleases(ctx context.Context, releaseClient releases.ReleaseClient, data *cicd.Data) error {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action": "createReleases",
+	})
+
+	policy := c.config.releaseRetryPolicy()
+	now := time.Now().UTC()
+
+	// releases unblocked or retried during a freeze are created once it is over
+	if reason, frozen, err := c.frozen(data, now, logger); err != nil {
+		logger.WithError(err).Error()
+		return err
+	} else if frozen {
+		logger.Infof("no release is created during freeze %q", reason)
+		return nil
+	}
+
 	var resultErr error = nil
-	for _, v := range data.AKSRelease {
-		release, err := releaseClient.CreateRelease(ctx, v.DefinitionID, v.Alias, strconv.Itoa(data.AKSBuild.ID), *data.AKSBuild.BuildNumber, fmt.Sprintf("Daily release: %s", data.Date))
+	for _, s := range c.flow.releaseStages() {
+		v := findRelease(data, s.Name)
+		if v == nil || v.ReleaseID != nil || v.State == cicd.ReleaseStateValues.Abandoned || v.State == cicd.ReleaseStateValues.Blocked {
+			continue
+		}
+		if !c.flow.dependenciesDone(data, s.Name) {
+			if c.flow.dependencyFailed(data, s.Name) {
+				v.State = cicd.ReleaseStateValues.Blocked
+				logger.Infof("release of stage %s is blocked by a failed dependency", s.Name)
+				continue
+			}
+			v.State = cicd.ReleaseStateValues.Pending
+			logger.Infof("release of stage %s is waiting for its dependencies", s.Name)
+			continue
+		}
+		if s.SoakMinutes > 0 && v.SoakUntil == nil {
+			soakFrom := now
+			if finish := c.flow.dependenciesFinishTime(data, s.Name); finish != nil {
+				soakFrom = *finish
+			}
+			soakUntil := soakFrom.Add(time.Duration(s.SoakMinutes) * time.Minute)
+			v.SoakUntil = &soakUntil
+		}
+		if v.SoakUntil != nil && now.Before(*v.SoakUntil) {
+			v.State = cicd.ReleaseStateValues.Soaking
+			logger.Infof("release of stage %s soaks until %s", s.Name, v.SoakUntil.Format(time.RFC3339))
+			continue
+		}
+		if v.RetryAfter != nil && now.Before(*v.RetryAfter) {
+			logger.Infof("release of stage %s will be created again after %s", s.Name, v.RetryAfter.Format(time.RFC3339))
+			continue
+		}
+
+		// a previous cycle may have created the release and crashed before persisting it
+		release, err := c.findCorrelatedRelease(ctx, releaseClient, v.DefinitionID, c.releaseCorrelationID(data, s.Name), data.Date)
+		if err == nil && release != nil {
+			c.plan.add("adopt release %d of stage %s", *release.Id, s.Name)
+			logger.Infof("adopted release %d of stage %s", *release.Id, s.Name)
+		} else if err == nil {
+			v.Attempts++
+			buildID, buildNumber := c.artifactOf(data, s.Build)
+			release, err = releaseClient.CreateRelease(ctx, v.DefinitionID, v.Alias, strconv.Itoa(buildID), buildNumber, c.releaseDescription(data, s.Name))
+		}
 		if err != nil {
 			logger.WithError(err).Error()
 			resultErr = err
-		} else {
-			v.ReleaseID = release.Id
-			v.ReleaseName = release.Name
+			v.LastError = err.Error()
+			v.State = cicd.ReleaseStateValues.CreateFailed
+			if v.Attempts >= policy.MaxAttempts {
+				v.State = cicd.ReleaseStateValues.Abandoned
+				v.RetryAfter = nil
+				logger.Warnf("release of stage %s is abandoned after %d attempts", s.Name, v.Attempts)
+				continue
+			}
+			retryAfter := now.Add(policy.Backoff(v.Attempts))
+			v.RetryAfter = &retryAfter
+			continue
 		}
-	}
 
-	data.State = cicd.DataStateValues.ReleaseInProgress
+		v.ReleaseID = release.Id
+		v.ReleaseName = release.Name
+		v.StartTime = timeOf(release.CreatedOn)
+		v.State = cicd.ReleaseStateValues.InProgress
+		v.LastError = ""
+		v.RetryAfter = nil
+	}
 	return resultErr
 }
 
-// MonitorRelease monitors the status of release
+// releasesStarted checks whether any definition has a release or gave up creating it
+func releasesStarted(data *cicd.Data) bool {
+	for _, r := range data.AKSRelease {
+		if r.ReleaseID != nil || r.State == cicd.ReleaseStateValues.Abandoned {
+			return true
+		}
+	}
+	return false
+}
+
+// artifactOf returns the id and number of the build produced by the build stage named stage
+func (c *MonitorClient) artifactOf(data *cicd.Data, stage string) (int, string) {
+	if c.flow.byName[stage].Type == StageTypeValues.QueueBuild && data.AKSBuild != nil {
+		return data.AKSBuild.ID, stringValue(data.AKSBuild.BuildNumber)
+	}
+	if data.MasterValidation != nil && data.MasterValidation.BuildID != nil {
+		return *data.MasterValidation.BuildID, stringValue(data.MasterValidation.BuildNumber)
+	}
+	return 0, ""
+}
+
+// MonitorRelease monitors the status of release, and creates the releases unblocked since the last cycle
 func (c *MonitorClient) MonitorRelease(ctx context.Context, data *cicd.Data) error {
 	logger := c.logger.WithFields(logrus.Fields{
 		"action": "MonitorRelease",
 	})
 
-	releaseClient, err := releases.BuildReleaseClient(logger, vstspat.NewPATEnvBackend(personalAccessTokenKey), c.config.Organization, c.config.Project)
+	releaseClient, err := c.releaseClient(logger)
 	if err != nil {
 		logger.WithError(err).Error()
 		return err
@@ -323,22 +684,171 @@ func (c *MonitorClient) MonitorRelease(ctx context.Context, data *cicd.Data) err
 
 	var resultErr error = nil
 	for _, v := range data.AKSRelease {
+		if v.ReleaseID == nil {
+			continue
+		}
 		release, err := releaseClient.GetReleaseByID(ctx, *v.ReleaseID)
 		if err != nil {
 			logger.WithError(err).Error()
 			resultErr = err
 		} else {
+			interventions, err := listInterventions(ctx, releaseClient, release)
+			if err != nil {
+				logger.WithError(err).Error()
+				resultErr = err
+			}
 			for _, s := range v.Staging {
+				if s.Status != nil && *s.Status == cicd.StagingStatusTimedOut {
+					// the abandoned deployment is reported as canceled by azure devops
+					continue
+				}
 				for _, e := range *release.Environments {
 					if strings.EqualFold(s.Name, *e.Name) {
-						status := string(*e.Status)
+						if s.Status != nil && *s.Status == cicd.StagingStatusRetryPending {
+							// the abandoned deployment is reported as canceled until it is deployed again
+							if err := c.retryStaging(ctx, releaseClient, data, v, s, &e, logger); err != nil {
+								logger.WithError(err).Error()
+								resultErr = err
+							}
+							break
+						}
+						status := stagingStatus(&e)
 						s.Status = &status
+						s.StartTime, s.FinishTime = stagingTimes(&e)
+						if err := c.timeoutStaging(ctx, releaseClient, v, s, &e, logger); err != nil {
+							logger.WithError(err).Error()
+							resultErr = err
+						}
+						if err := c.driveStaging(ctx, releaseClient, data, v, s, &e, interventions, logger); err != nil {
+							logger.WithError(err).Error()
+							resultErr = err
+						}
 						break
 					}
 				}
 			}
+			v.FinishTime = releaseFinishTime(v)
+			v.UpdateState()
 		}
 	}
 
-	return resultErr
+	if resultErr != nil {
+		return resultErr
+	}
+
+	if err := c.createReleases(ctx, releaseClient, data); err != nil {
+		return err
+	}
+
+	next, failure := cicd.ReleaseOutcome(data.AKSRelease)
+	buildID, _ := c.artifactOf(data, c.flow.buildStage().Name)
+	reason := fmt.Sprintf("releases of build %d are %s", buildID, next)
+	if failure != nil {
+		logger.Warnln(failure.Reason)
+		data.Failure = failure
+		reason = failure.Reason
+	}
+	if err := data.TransitionTo(next, reason); err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+	return nil
+}
+
+// stagingStatus returns the status of release environment, a rejected environment whose
+// latest deployment failed is reported as failed to tell it apart from rejected approvals
+func stagingStatus(e *vstsrelease.ReleaseEnvironment) string {
+	status := string(*e.Status)
+	if *e.Status != vstsrelease.EnvironmentStatusValues.Rejected {
+		return status
+	}
+
+	latest := latestDeployStep(e)
+	if latest != nil && latest.Status != nil && *latest.Status == vstsrelease.DeploymentStatusValues.Failed {
+		return cicd.StagingStatusFailed
+	}
+	return status
+}
+
+// latestDeployStep returns the latest deployment attempt of release environment, nil if none
+func latestDeployStep(e *vstsrelease.ReleaseEnvironment) *vstsrelease.DeploymentAttempt {
+	if e.DeploySteps == nil {
+		return nil
+	}
+
+	var latest *vstsrelease.DeploymentAttempt
+	for i, step := range *e.DeploySteps {
+		if latest == nil || (step.Attempt != nil && latest.Attempt != nil && *step.Attempt > *latest.Attempt) {
+			latest = &(*e.DeploySteps)[i]
+		}
+	}
+	return latest
+}
+
+// stagingTimes returns when the deployment of release environment started and finished,
+// the finish time is only set once the environment reached a final status
+func stagingTimes(e *vstsrelease.ReleaseEnvironment) (*time.Time, *time.Time) {
+	if e.DeploySteps == nil || len(*e.DeploySteps) == 0 {
+		return nil, nil
+	}
+
+	var start, finish *time.Time
+	for _, step := range *e.DeploySteps {
+		queued := timeOf(step.QueuedOn)
+		if queued != nil && (start == nil || queued.Before(*start)) {
+			start = queued
+		}
+		if step.ReleaseDeployPhases != nil {
+			for _, phase := range *step.ReleaseDeployPhases {
+				started := timeOf(phase.StartedOn)
+				if started != nil && (start == nil || started.Before(*start)) {
+					start = started
+				}
+			}
+		}
+		modified := timeOf(step.LastModifiedOn)
+		if modified != nil && (finish == nil || modified.After(*finish)) {
+			finish = modified
+		}
+	}
+
+	switch *e.Status {
+	case vstsrelease.EnvironmentStatusValues.Succeeded,
+		vstsrelease.EnvironmentStatusValues.PartiallySucceeded,
+		vstsrelease.EnvironmentStatusValues.Rejected,
+		vstsrelease.EnvironmentStatusValues.Canceled:
+		return start, finish
+	default:
+		return start, nil
+	}
+}
+
+// releaseFinishTime returns when the last staging of release finished, nil if any staging is not finished
+func releaseFinishTime(r *cicd.AKSRelease) *time.Time {
+	var finish *time.Time
+	for _, s := range r.Staging {
+		if s.FinishTime == nil {
+			return nil
+		}
+		if finish == nil || s.FinishTime.After(*finish) {
+			finish = s.FinishTime
+		}
+	}
+	return finish
+}
+
+// timeOf converts a time of Azure DevOps API to UTC
+func timeOf(t *vsts.Time) *time.Time {
+	if t == nil || t.Time.IsZero() {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
 }
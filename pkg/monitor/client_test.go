@@ -0,0 +1,124 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+// TestReconcileDay walks a day through the legacy chain, each step changes azure devops and runs
+// one cycle
+func TestReconcileDay(t *testing.T) {
+	c, pipelineClient, releaseClient := newTestClient(t, testConfig())
+	ctx := context.Background()
+
+	var data *cicd.Data
+	steps := []struct {
+		name   string
+		change func()
+		want   cicd.DataState
+	}{
+		{
+			name: "no validated commit",
+			want: cicd.DataStateValues.None,
+		},
+		{
+			name:   "commit validated",
+			change: func() { pipelineClient.validate(1, "abc123") },
+			want:   cicd.DataStateValues.NotStart,
+		},
+		{
+			name: "build running",
+			want: cicd.DataStateValues.BuildInProgress,
+		},
+		{
+			name:   "build succeeded",
+			change: func() { pipelineClient.complete(data.AKSBuild.ID, vstsbuild.BuildResultValues.Succeeded) },
+			want:   cicd.DataStateValues.BuildSucceeded,
+		},
+		{
+			name: "release created",
+			want: cicd.DataStateValues.ReleaseInProgress,
+		},
+		{
+			name: "staging running",
+			want: cicd.DataStateValues.ReleaseInProgress,
+		},
+		{
+			name: "staging succeeded",
+			change: func() {
+				releaseClient.setStaging(*data.AKSRelease[0].ReleaseID, "canary", vstsrelease.EnvironmentStatusValues.Succeeded)
+			},
+			want: cicd.DataStateValues.ReleaseSucceeded,
+		},
+	}
+
+	for _, step := range steps {
+		if step.change != nil {
+			step.change()
+		}
+		var err error
+		data, err = c.reconcile(ctx)
+		if err != nil {
+			t.Fatalf("%s: reconcile() error = %v", step.name, err)
+		}
+		if data.State != step.want {
+			t.Fatalf("%s: state = %s, want %s", step.name, data.State, step.want)
+		}
+	}
+
+	if len(pipelineClient.queued) != 1 {
+		t.Errorf("queued %d builds, want 1", len(pipelineClient.queued))
+	}
+	if len(releaseClient.created) != 1 {
+		t.Errorf("created %d releases, want 1", len(releaseClient.created))
+	}
+	if got := data.AKSRelease[0].State; got != cicd.ReleaseStateValues.Succeeded {
+		t.Errorf("release state = %s, want %s", got, cicd.ReleaseStateValues.Succeeded)
+	}
+}
+
+// TestReconcileAdoptsBuild checks a build queued by a cycle which wasn't persisted is adopted
+func TestReconcileAdoptsBuild(t *testing.T) {
+	c, pipelineClient, _ := newTestClient(t, testConfig())
+	ctx := context.Background()
+	pipelineClient.validate(1, "abc123")
+
+	date := c.Today()
+	pipelineClient.queue(2, "abc123", []string{c.buildCorrelationID(&cicd.Data{Date: date}, 1)})
+
+	data, err := c.reconcile(ctx)
+	if err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	if len(pipelineClient.queued) != 1 {
+		t.Errorf("queued %d builds, want the adopted one only", len(pipelineClient.queued))
+	}
+	if data.State != cicd.DataStateValues.NotStart {
+		t.Errorf("state = %s, want %s", data.State, cicd.DataStateValues.NotStart)
+	}
+}
+
+func TestCorrelationSince(t *testing.T) {
+	tests := []struct {
+		timezone string
+		want     string
+	}{
+		{timezone: "", want: "2021-02-28T00:00:00Z"},
+		{timezone: "Asia/Shanghai", want: "2021-02-27T16:00:00Z"},
+		{timezone: "America/Los_Angeles", want: "2021-02-28T08:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		config := testConfig()
+		config.Schedule = &ScheduleConfig{Timezone: tt.timezone}
+		c, _, _ := newTestClient(t, config)
+		if got := c.correlationSince("2021-03-01").UTC().Format(time.RFC3339); got != tt.want {
+			t.Errorf("correlationSince() in %q = %s, want %s", tt.timezone, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package monitor
+
+import "fmt"
+
+// Config is the configuration of the monitor. The flow can be declared at the top level for a
+// single flow, or as a list in Flows to monitor several flows in one process.
+type Config struct {
+	FlowConfig
+
+	// Flows are monitored concurrently, the top level flow is used if empty
+	Flows []*FlowConfig `json:"flows,omitempty"`
+
+	AzureStorageAccount   string `json:"azure_storage_account"`
+	AzureStorageContainer string `json:"azure_storage_container"`
+
+	// Supervisor controls the monitor loop
+	Supervisor *SupervisorConfig `json:"supervisor,omitempty"`
+
+	// StateStore selects where the daily data is persisted, defaults to azure storage account blob
+	StateStore *StateStoreConfig `json:"state_store,omitempty"`
+
+	// LeaderElection lets several replicas of the monitor run side by side
+	LeaderElection *LeaderElectionConfig `json:"leader_election,omitempty"`
+}
+
+// FlowConfig is the configuration of a single flow
+type FlowConfig struct {
+	// Name identifies the flow in logs, metrics and status, required when several flows are declared
+	Name string `json:"name,omitempty"`
+
+	Organization          string     `json:"organization"`
+	Project               string     `json:"project"`
+	MasterValidationE2EID int        `json:"master_validation_e2e_id"`
+	AksBuildID            int        `json:"aks_build_id"`
+	AksRelease            []*Release `json:"aks_release"`
+
+	// MasterValidationGates are validation pipelines the commit must pass in addition to MasterValidationE2EID
+	MasterValidationGates []*ValidationGate `json:"master_validation_gates,omitempty"`
+
+	// Stages declares the flow, the chain of MasterValidationE2EID, AksBuildID and AksRelease is used if empty.
+	// A flow has at most one pickBuild and one queueBuild stage, the day keeps a single build of each.
+	Stages []*Stage `json:"stages,omitempty"`
+
+	// AksBuildRetry controls how a failed [EV2] AKS Build is retried
+	AksBuildRetry *RetryPolicy `json:"aks_build_retry,omitempty"`
+
+	// ReleaseLookbackDays is the number of earlier days searched for the released commit, the day
+	// ends without changes if the picked commit is the released one. Defaults to 7.
+	ReleaseLookbackDays int `json:"release_lookback_days,omitempty"`
+
+	// ReleaseRetry controls how creating the release of a definition is retried, the infrastructure
+	// failure fields are ignored
+	ReleaseRetry *RetryPolicy `json:"release_retry,omitempty"`
+
+	// Deployment lets the monitor deploy and approve the stagings of the flow
+	Deployment *DeploymentPolicy `json:"deployment,omitempty"`
+
+	// Timeouts sets the timeouts of the stages of the chain of MasterValidationE2EID, AksBuildID and AksRelease
+	Timeouts *TimeoutConfig `json:"timeouts,omitempty"`
+
+	// CarryOver controls how the days unfinished at the end of their date are carried over
+	CarryOver *CarryOverConfig `json:"carry_over,omitempty"`
+
+	// Schedule controls when the monitor works on a day, the day starts at UTC midnight if not set
+	Schedule *ScheduleConfig `json:"schedule,omitempty"`
+
+	// Freeze declares when no new build or release is started, the top level freeze is used by the
+	// flows which don't declare one
+	Freeze *FreezeConfig `json:"freeze,omitempty"`
+
+	// BlobPrefix is prepended to the name of the daily blob, defaults to "<name>/" when several flows are declared
+	BlobPrefix *string `json:"blob_prefix,omitempty"`
+}
+
+// StateStoreConfig describes the backend of the state store
+type StateStoreConfig struct {
+	Type      string `json:"type"`
+	Directory string `json:"directory,omitempty"`
+}
+
+type Release struct {
+	DefinitionID int      `json:"definition_id"`
+	Alias        string   `json:"source_alias"`
+	Stagings     []string `json:"staging"`
+
+	// After delays the release until the releases it depends on progressed, releases without
+	// dependencies are created as soon as the build succeeded
+	After []*ReleaseDependency `json:"after,omitempty"`
+
+	// SoakMinutes is the time to wait after the dependencies are done before creating the release
+	SoakMinutes int `json:"soak_minutes,omitempty"`
+}
+
+// ReleaseDependency is a release which must progress before another release is created
+type ReleaseDependency struct {
+	DefinitionID int `json:"definition_id"`
+
+	// Stagings of the release which must succeed, all its stagings if empty
+	Stagings []string `json:"staging,omitempty"`
+}
+
+// flows returns the flows of config with defaults applied
+func (c *Config) flows() ([]*FlowConfig, error) {
+	if len(c.Flows) == 0 {
+		flow := c.FlowConfig
+		if flow.BlobPrefix == nil {
+			prefix := ""
+			flow.BlobPrefix = &prefix
+		}
+		return []*FlowConfig{&flow}, nil
+	}
+
+	names := map[string]bool{}
+	var result []*FlowConfig
+	for i, f := range c.Flows {
+		if f.Name == "" {
+			return nil, fmt.Errorf("flow %d has no name", i)
+		}
+		if names[f.Name] {
+			return nil, fmt.Errorf("flow %q is declared more than once", f.Name)
+		}
+		names[f.Name] = true
+
+		flow := *f
+		if flow.BlobPrefix == nil {
+			prefix := flow.Name + "/"
+			flow.BlobPrefix = &prefix
+		}
+		if flow.Freeze == nil {
+			flow.Freeze = c.Freeze
+		}
+		result = append(result, &flow)
+	}
+	return result, nil
+}
+
+// name identifies the flow in logs, metrics and status
+func (c *FlowConfig) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Organization + "/" + c.Project
+}
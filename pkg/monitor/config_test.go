@@ -0,0 +1,122 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+func TestConfigFlows(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		wantNames    []string
+		wantPrefixes []string
+		wantFreeze   []bool
+		wantErr      string
+	}{
+		{
+			name:         "single flow",
+			config:       `{"organization": "org", "project": "aks", "aks_build_id": 2}`,
+			wantNames:    []string{"org/aks"},
+			wantPrefixes: []string{""},
+			wantFreeze:   []bool{false},
+		},
+		{
+			name: "several flows",
+			config: `{
+				"freeze": {"weekdays": ["saturday"]},
+				"flows": [
+					{"name": "aks", "aks_build_id": 2},
+					{"name": "fleet", "aks_build_id": 3, "blob_prefix": "fleet-daily-", "freeze": {}}
+				]
+			}`,
+			wantNames:    []string{"aks", "fleet"},
+			wantPrefixes: []string{"aks/", "fleet-daily-"},
+			wantFreeze:   []bool{true, false},
+		},
+		{
+			name:    "unnamed flow",
+			config:  `{"flows": [{"name": "aks"}, {"aks_build_id": 3}]}`,
+			wantErr: "flow 1 has no name",
+		},
+		{
+			name:    "duplicate flow",
+			config:  `{"flows": [{"name": "aks"}, {"name": "aks"}]}`,
+			wantErr: `flow "aks" is declared more than once`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config Config
+			if err := json.Unmarshal([]byte(tt.config), &config); err != nil {
+				t.Fatal(err)
+			}
+
+			flows, err := config.flows()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("flows() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("flows() error = %v", err)
+			}
+			if len(flows) != len(tt.wantNames) {
+				t.Fatalf("flows() returned %d flows, want %d", len(flows), len(tt.wantNames))
+			}
+			for i, f := range flows {
+				if f.name() != tt.wantNames[i] {
+					t.Errorf("name of flow %d = %q, want %q", i, f.name(), tt.wantNames[i])
+				}
+				if *f.BlobPrefix != tt.wantPrefixes[i] {
+					t.Errorf("blob prefix of flow %s = %q, want %q", f.name(), *f.BlobPrefix, tt.wantPrefixes[i])
+				}
+				if frozen := f.Freeze != nil && len(f.Freeze.Weekdays) > 0; frozen != tt.wantFreeze[i] {
+					t.Errorf("flow %s inherits the top level freeze = %v, want %v", f.name(), frozen, tt.wantFreeze[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBuildMonitorFlows(t *testing.T) {
+	config := &Config{
+		Flows: []*FlowConfig{
+			{Name: "aks", MasterValidationE2EID: 1, AksBuildID: 2},
+			{Name: "fleet", MasterValidationE2EID: 1, AksBuildID: 3},
+		},
+		StateStore: &StateStoreConfig{Type: statestore.TypeMemory},
+	}
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	m, err := BuildMonitor("", "", config, logger)
+	if err != nil {
+		t.Fatalf("BuildMonitor() error = %v", err)
+	}
+	if len(m.clients) != 2 {
+		t.Fatalf("BuildMonitor() created %d clients, want 2", len(m.clients))
+	}
+
+	blobs := map[string]bool{}
+	for _, c := range m.clients {
+		blobs[c.blobName("2021-03-01")] = true
+	}
+	if !blobs["aks/2021-03-01"] || !blobs["fleet/2021-03-01"] {
+		t.Errorf("blobs = %v, want a blob per flow", blobs)
+	}
+
+	if c, err := m.Client("fleet"); err != nil || c.flow.buildStage().PipelineID != 3 {
+		t.Errorf("Client(fleet) = %v, %v, want the client of pipeline 3", c, err)
+	}
+	if _, err := m.Client(""); err == nil {
+		t.Error("Client() selected a flow among several")
+	}
+}
@@ -0,0 +1,159 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+// maxMergeAttempts bounds how many times a cycle merges concurrent modifications before giving up
+const maxMergeAttempts = 3
+
+// ConflictError is returned when the data was modified concurrently in a way that can't be merged
+// with the changes of the cycle
+type ConflictError struct {
+	Fields []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("data was modified concurrently, conflicting fields: %s", strings.Join(e.Fields, ", "))
+}
+
+// saveData persists data, which the cycle derived from base read at version. If the data was
+// modified in the meantime, the latest data is re-read and merged with the changes of the cycle,
+// the cycle is aborted without writing if both changed the same fields. The data which was
+// persisted, or the latest data if the cycle was aborted, is returned.
+func (c *MonitorClient) saveData(ctx context.Context, date string, base *cicd.Data, data *cicd.Data, version string) (*cicd.Data, error) {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action": "saveData",
+		"date":   date,
+	})
+
+	for attempt := 1; ; attempt++ {
+		_, err := c.UploadDataToBlob(ctx, date, data, version)
+		if !errors.Is(err, statestore.ErrConflict) {
+			return data, err
+		}
+		if attempt >= maxMergeAttempts {
+			stateStoreConflicts.WithLabelValues(c.flowName(), "aborted").Inc()
+			return nil, fmt.Errorf("data was modified concurrently %d times in a row: %w", attempt, err)
+		}
+
+		latest, latestVersion, err := c.GetDataFromBlob(ctx, date)
+		if err != nil {
+			return nil, err
+		}
+
+		merged, err := mergeData(base, data, latest)
+		if err != nil {
+			stateStoreConflicts.WithLabelValues(c.flowName(), "aborted").Inc()
+			logger.WithError(err).Error("changes of the cycle are dropped")
+			return latest, err
+		}
+		stateStoreConflicts.WithLabelValues(c.flowName(), "merged").Inc()
+		logger.Infof("merged the changes of the cycle with data at version %s", latestVersion)
+
+		base, err = copyData(latest)
+		if err != nil {
+			return nil, err
+		}
+		data, version = merged, latestVersion
+	}
+}
+
+// mergeData applies the changes from base to ours onto theirs. The top level fields of the data are
+// merged: a field changed on one side only is taken from that side, a field changed differently on
+// both sides is a conflict.
+func mergeData(base *cicd.Data, ours *cicd.Data, theirs *cicd.Data) (*cicd.Data, error) {
+	baseFields, err := dataFields(base)
+	if err != nil {
+		return nil, err
+	}
+	ourFields, err := dataFields(ours)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := dataFields(theirs)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []string
+	for _, name := range fieldNames(baseFields, ourFields, merged) {
+		if bytes.Equal(ourFields[name], baseFields[name]) {
+			continue
+		}
+		if !bytes.Equal(merged[name], baseFields[name]) && !bytes.Equal(merged[name], ourFields[name]) {
+			conflicts = append(conflicts, name)
+			continue
+		}
+		if ourFields[name] == nil {
+			delete(merged, name)
+		} else {
+			merged[name] = ourFields[name]
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, &ConflictError{Fields: conflicts}
+	}
+
+	content, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	var data cicd.Data
+	if err = json.Unmarshal(content, &data); err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// copyData returns a deep copy of data
+func copyData(data *cicd.Data) (*cicd.Data, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var result cicd.Data
+	if err = json.Unmarshal(content, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// dataFields returns the serialized top level fields of data
+func dataFields(data *cicd.Data) (map[string]json.RawMessage, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err = json.Unmarshal(content, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// fieldNames returns the sorted names of the fields of all sets
+func fieldNames(sets ...map[string]json.RawMessage) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, fields := range sets {
+		for name := range fields {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
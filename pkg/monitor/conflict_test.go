@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+func TestMergeData(t *testing.T) {
+	base := func() *cicd.Data {
+		return &cicd.Data{
+			Date:     "2021-03-01",
+			State:    cicd.DataStateValues.NotStart,
+			AKSBuild: &cicd.AKSBuild{ID: 1, Count: 1},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		ours          func(d *cicd.Data)
+		theirs        func(d *cicd.Data)
+		want          func(d *cicd.Data)
+		wantConflicts []string
+	}{
+		{
+			name:   "only theirs changed",
+			ours:   func(d *cicd.Data) {},
+			theirs: func(d *cicd.Data) { d.Paused = true },
+			want:   func(d *cicd.Data) { d.Paused = true },
+		},
+		{
+			name:   "different fields changed",
+			ours:   func(d *cicd.Data) { d.State = cicd.DataStateValues.BuildInProgress },
+			theirs: func(d *cicd.Data) { d.Paused = true },
+			want: func(d *cicd.Data) {
+				d.State = cicd.DataStateValues.BuildInProgress
+				d.Paused = true
+			},
+		},
+		{
+			name:   "same change on both sides",
+			ours:   func(d *cicd.Data) { d.State = cicd.DataStateValues.BuildInProgress },
+			theirs: func(d *cicd.Data) { d.State = cicd.DataStateValues.BuildInProgress },
+			want:   func(d *cicd.Data) { d.State = cicd.DataStateValues.BuildInProgress },
+		},
+		{
+			name:   "field removed by us",
+			ours:   func(d *cicd.Data) { d.AKSBuild = nil },
+			theirs: func(d *cicd.Data) { d.Paused = true },
+			want: func(d *cicd.Data) {
+				d.AKSBuild = nil
+				d.Paused = true
+			},
+		},
+		{
+			name:          "same field changed differently",
+			ours:          func(d *cicd.Data) { d.State = cicd.DataStateValues.BuildInProgress },
+			theirs:        func(d *cicd.Data) { d.State = cicd.DataStateValues.BuildFailed },
+			wantConflicts: []string{"state"},
+		},
+		{
+			name: "nested field changed differently",
+			ours: func(d *cicd.Data) { d.AKSBuild.Count = 2 },
+			theirs: func(d *cicd.Data) {
+				d.AKSBuild.ID = 2
+				d.State = cicd.DataStateValues.BuildFailed
+			},
+			wantConflicts: []string{"ev2_aks_build"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ours, theirs := base(), base()
+			tt.ours(ours)
+			tt.theirs(theirs)
+
+			merged, err := mergeData(base(), ours, theirs)
+			if tt.wantConflicts != nil {
+				var conflict *ConflictError
+				if !errors.As(err, &conflict) {
+					t.Fatalf("mergeData() error = %v, want a ConflictError", err)
+				}
+				if !reflect.DeepEqual(conflict.Fields, tt.wantConflicts) {
+					t.Errorf("conflicting fields = %v, want %v", conflict.Fields, tt.wantConflicts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeData() error = %v", err)
+			}
+
+			want := base()
+			tt.want(want)
+			if !reflect.DeepEqual(merged, want) {
+				t.Errorf("mergeData() = %+v, want %+v", merged, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/pipelines"
+	"github.com/yangzuo0621/monitor/pkg/releases"
+)
+
+// correlationLookback is how long before the day began builds and releases of the day are looked up
+const correlationLookback = 24 * time.Hour
+
+var invalidCorrelationChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// correlationID identifies what the monitor queued for the flow on date, it is used as build tag
+// and in release descriptions so that a build or release queued by a cycle which crashed before
+// persisting its data is adopted instead of queued again
+func (c *MonitorClient) correlationID(date string, parts ...string) string {
+	id := strings.Join(append([]string{"monitor", c.config.name(), date}, parts...), "-")
+	return invalidCorrelationChars.ReplaceAllString(id, "_")
+}
+
+// dayCorrelationID identifies what the monitor queued for the current generation of the day of data,
+// the generation is left out until the day is started over so that earlier ids stay valid
+func (c *MonitorClient) dayCorrelationID(data *cicd.Data, parts ...string) string {
+	if data.Generation > 0 {
+		parts = append([]string{fmt.Sprintf("g%d", data.Generation)}, parts...)
+	}
+	return c.correlationID(data.Date, parts...)
+}
+
+// buildCorrelationID identifies the attempt of the build of the day of data
+func (c *MonitorClient) buildCorrelationID(data *cicd.Data, attempt int) string {
+	return c.dayCorrelationID(data, "build", fmt.Sprint(attempt))
+}
+
+// releaseCorrelationID identifies the release of the stage named stage of the day of data
+func (c *MonitorClient) releaseCorrelationID(data *cicd.Data, stage string) string {
+	return c.dayCorrelationID(data, stage)
+}
+
+// releaseDescription returns the description of the release of the stage named stage of the day of data
+func (c *MonitorClient) releaseDescription(data *cicd.Data, stage string) string {
+	return fmt.Sprintf("Daily release: %s [%s]", data.Date, c.releaseCorrelationID(data, stage))
+}
+
+// correlationSince returns the time since which builds and releases of date are looked up, the day
+// begins at midnight of the timezone of the schedule
+func (c *MonitorClient) correlationSince(date string) time.Time {
+	day, err := c.schedule.startOfDay(date)
+	if err != nil {
+		return time.Now().UTC().Add(-correlationLookback)
+	}
+	return day.Add(-correlationLookback)
+}
+
+// findCorrelatedBuild returns the newest build of pipeline tagged with tag, nil if there is none
+func (c *MonitorClient) findCorrelatedBuild(ctx context.Context, pipelineClient pipelines.PipelineClient, pipelineID int, tag string, date string) (*vstsbuild.Build, error) {
+	builds, err := pipelineClient.ListBuildsByTag(ctx, pipelineID, tag, c.correlationSince(date))
+	if err != nil {
+		return nil, err
+	}
+	if len(builds) == 0 {
+		return nil, nil
+	}
+	return builds[0], nil
+}
+
+// findCorrelatedRelease returns the release of definition whose description mentions id, nil if there is none
+func (c *MonitorClient) findCorrelatedRelease(ctx context.Context, releaseClient releases.ReleaseClient, definitionID int, id string, date string) (*vstsrelease.Release, error) {
+	list, err := releaseClient.ListReleasesByDefinition(ctx, definitionID, c.correlationSince(date))
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range list {
+		if r.Description != nil && strings.Contains(*r.Description, "["+id+"]") {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
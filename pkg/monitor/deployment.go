@@ -0,0 +1,195 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	webapi "github.com/microsoft/azure-devops-go-api/azuredevops/webapi"
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/releases"
+)
+
+// deployRetryInterval is how long a staging whose deployment was requested may stay notStarted
+// before the deployment is requested again
+const deployRetryInterval = 10 * time.Minute
+
+// DeploymentPolicy lets the monitor deploy and approve stagings instead of waiting for someone to
+// do it in the portal. Nothing is deployed or approved during a freeze unless it is overridden.
+type DeploymentPolicy struct {
+	// Deploy lists the stagings with a manual trigger the monitor deploys, each once the stagings
+	// before it in its stage succeeded
+	Deploy []string `json:"deploy,omitempty"`
+
+	// Approve approves the pending pre-deployment approvals of the stagings assigned to Approver
+	Approve bool `json:"approve,omitempty"`
+
+	// Approver is the unique name, display name or id of the identity the monitor acts as
+	Approver string `json:"approver,omitempty"`
+
+	// ApproveAfterMinutes leaves people time to reject an approval before the monitor approves it
+	ApproveAfterMinutes int `json:"approve_after_minutes,omitempty"`
+
+	// Interventions resume or reject the manual interventions and gates the stagings wait for, the
+	// first rule matching a manual intervention or gate applies
+	Interventions []*InterventionRule `json:"interventions,omitempty"`
+}
+
+func (p *DeploymentPolicy) validate() error {
+	if p.Approve && p.Approver == "" {
+		return fmt.Errorf("approver is required to approve")
+	}
+	if p.ApproveAfterMinutes < 0 {
+		return fmt.Errorf("approve_after_minutes must not be negative")
+	}
+	for i, r := range p.Interventions {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("invalid intervention rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// deploymentPolicy returns the deployment policy of the WaitForStaging stage named stage, nil if none
+func (c *MonitorClient) deploymentPolicy(stage string) *DeploymentPolicy {
+	if s, ok := c.flow.byName[stage]; ok && s.Deployment != nil {
+		return s.Deployment
+	}
+	return c.config.Deployment
+}
+
+// driveStaging records who approved the staging and what it waits for and, according to the
+// deployment policy of its stage, approves its pending approvals, resolves its manual interventions
+// and gates and deploys it
+func (c *MonitorClient) driveStaging(
+	ctx context.Context,
+	releaseClient releases.ReleaseClient,
+	data *cicd.Data,
+	release *cicd.AKSRelease,
+	staging *cicd.Staging,
+	environment *vstsrelease.ReleaseEnvironment,
+	interventions []*vstsrelease.ManualIntervention,
+	logger logrus.FieldLogger,
+) error {
+	policy := c.deploymentPolicy(staging.Stage)
+	recordApproval(staging, environment)
+	recordInterventions(staging, environment, interventions, policy)
+
+	if policy == nil || staging.Status == nil || *staging.Status == cicd.StagingStatusTimedOut {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	if reason, frozen, err := c.frozen(data, now, logger); err != nil {
+		return err
+	} else if frozen {
+		logger.Infof("staging %s isn't driven during freeze %q", staging.Name, reason)
+		return nil
+	}
+
+	if policy.Approve && environment.PreDeployApprovals != nil {
+		for _, a := range *environment.PreDeployApprovals {
+			if a.Id == nil || a.Status == nil || *a.Status != vstsrelease.ApprovalStatusValues.Pending || !isIdentity(a.Approver, policy.Approver) {
+				continue
+			}
+			created := timeOf(a.CreatedOn)
+			if created != nil && now.Sub(*created) < time.Duration(policy.ApproveAfterMinutes)*time.Minute {
+				logger.Infof("approval %d of staging %s is approved after %d minutes", *a.Id, staging.Name, policy.ApproveAfterMinutes)
+				continue
+			}
+
+			comment := fmt.Sprintf("approved by the monitor for %s", data.Date)
+			if err := releaseClient.ApproveRelease(ctx, *a.Id, comment); err != nil {
+				return err
+			}
+			staging.ApprovedBy = policy.Approver
+			staging.ApprovedAt = &now
+			logger.Infof("approved approval %d of staging %s", *a.Id, staging.Name)
+		}
+	}
+
+	if err := c.resolveInterventions(ctx, releaseClient, data, release, staging, environment, policy, now, logger); err != nil {
+		return err
+	}
+
+	if containsFold(policy.Deploy, staging.Name) &&
+		*staging.Status == string(vstsrelease.EnvironmentStatusValues.NotStarted) &&
+		environment.Id != nil &&
+		previousStagingsSucceeded(release, staging) {
+		// a requested deployment which never started is requested again
+		if staging.DeployRequestedAt != nil {
+			if now.Sub(*staging.DeployRequestedAt) < deployRetryInterval {
+				return nil
+			}
+			logger.Warnf("deployment of staging %s requested at %s didn't start, requesting it again", staging.Name, staging.DeployRequestedAt.Format(time.RFC3339))
+		}
+
+		comment := fmt.Sprintf("deployed by the monitor for %s", data.Date)
+		if err := releaseClient.DeployReleaseEnvironment(ctx, *release.ReleaseID, *environment.Id, comment); err != nil {
+			staging.DeployRequestedAt = nil
+			return err
+		}
+		staging.DeployRequestedAt = &now
+		logger.Infof("deployed staging %s of release %d", staging.Name, *release.ReleaseID)
+	}
+	return nil
+}
+
+// recordApproval records in staging the latest approved pre-deployment approval of environment
+func recordApproval(staging *cicd.Staging, environment *vstsrelease.ReleaseEnvironment) {
+	if environment.PreDeployApprovals == nil {
+		return
+	}
+	for _, a := range *environment.PreDeployApprovals {
+		if a.Status == nil || *a.Status != vstsrelease.ApprovalStatusValues.Approved || a.IsAutomated != nil && *a.IsAutomated {
+			continue
+		}
+		approvedAt := timeOf(a.ModifiedOn)
+		if approvedAt == nil || staging.ApprovedAt != nil && !approvedAt.After(*staging.ApprovedAt) {
+			continue
+		}
+		staging.ApprovedAt = approvedAt
+		staging.ApprovedBy = identityName(a.ApprovedBy)
+	}
+}
+
+// previousStagingsSucceeded checks whether the stagings of release declared before staging in its
+// stage succeeded
+func previousStagingsSucceeded(release *cicd.AKSRelease, staging *cicd.Staging) bool {
+	for _, s := range release.Staging {
+		if s == staging {
+			return true
+		}
+		if s.Stage == staging.Stage && (s.Status == nil || !stagingSucceeded(*s.Status)) {
+			return false
+		}
+	}
+	return true
+}
+
+// identityName returns the unique name of identity, or its display name if it has none
+func identityName(identity *webapi.IdentityRef) string {
+	if identity == nil {
+		return ""
+	}
+	if name := stringValue(identity.UniqueName); name != "" {
+		return name
+	}
+	return stringValue(identity.DisplayName)
+}
+
+// isIdentity checks whether identity is named name by its unique name, display name or id
+func isIdentity(identity *webapi.IdentityRef, name string) bool {
+	if identity == nil {
+		return false
+	}
+	for _, v := range []*string{identity.UniqueName, identity.DisplayName, identity.Id} {
+		if v != nil && strings.EqualFold(*v, name) {
+			return true
+		}
+	}
+	return false
+}
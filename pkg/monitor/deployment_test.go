@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/releases"
+)
+
+// failingDeployClient fails every deployment request
+type failingDeployClient struct {
+	*fakeReleaseClient
+}
+
+func (c *failingDeployClient) DeployReleaseEnvironment(ctx context.Context, releaseID int, environmentID int, comment string) error {
+	return errors.New("deployment failed")
+}
+
+func TestDriveStagingDeploy(t *testing.T) {
+	tests := []struct {
+		name          string
+		requestedAgo  time.Duration
+		fail          bool
+		wantDeployed  int
+		wantRequested bool
+		wantErr       bool
+	}{
+		{name: "first request", wantDeployed: 1, wantRequested: true},
+		{name: "request pending", requestedAgo: time.Minute, wantDeployed: 0, wantRequested: true},
+		{name: "request never started", requestedAgo: deployRetryInterval + time.Minute, wantDeployed: 1, wantRequested: true},
+		{name: "request failed", requestedAgo: deployRetryInterval + time.Minute, fail: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.Deployment = &DeploymentPolicy{Deploy: []string{"canary"}}
+			c, _, releaseClient := newTestClient(t, config)
+
+			releaseID, environmentID := 1000, 10000
+			status := string(vstsrelease.EnvironmentStatusValues.NotStarted)
+			staging := &cicd.Staging{Name: "canary", Status: &status}
+			if tt.requestedAgo > 0 {
+				requestedAt := time.Now().UTC().Add(-tt.requestedAgo)
+				staging.DeployRequestedAt = &requestedAt
+			}
+			release := &cicd.AKSRelease{DefinitionID: 10, ReleaseID: &releaseID, Staging: []*cicd.Staging{staging}}
+			data := &cicd.Data{Date: c.Today(), AKSRelease: []*cicd.AKSRelease{release}}
+			environment := &vstsrelease.ReleaseEnvironment{Id: &environmentID, Name: &staging.Name}
+
+			var client releases.ReleaseClient = releaseClient
+			if tt.fail {
+				client = &failingDeployClient{releaseClient}
+			}
+			err := c.driveStaging(context.Background(), client, data, release, staging, environment, nil, c.logger)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("driveStaging() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(releaseClient.deployed) != tt.wantDeployed {
+				t.Errorf("deployed %d times, want %d", len(releaseClient.deployed), tt.wantDeployed)
+			}
+			if (staging.DeployRequestedAt != nil) != tt.wantRequested {
+				t.Errorf("deploy requested at %v, want requested %v", staging.DeployRequestedAt, tt.wantRequested)
+			}
+		})
+	}
+}
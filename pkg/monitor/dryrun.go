@@ -0,0 +1,158 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/pipelines"
+	"github.com/yangzuo0621/monitor/pkg/releases"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+// dryRunBuildURI is the uri of the builds a dry run pretends to queue
+const dryRunBuildURI = "vstfs:///Build/Build/0"
+
+// plan records the actions of a dry run, a nil plan records nothing
+type plan struct {
+	mu      sync.Mutex
+	actions []string
+}
+
+func (p *plan) add(format string, args ...interface{}) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.actions = append(p.actions, fmt.Sprintf(format, args...))
+}
+
+func (p *plan) list() []string {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.actions...)
+}
+
+// pipelineClient creates the pipeline client of the flow, mutating calls are only planned in a dry run
+func (c *MonitorClient) pipelineClient(logger logrus.FieldLogger) (pipelines.PipelineClient, error) {
+	client, err := c.newPipelineClient(logger)
+	if err != nil || c.plan == nil {
+		return client, err
+	}
+	return &dryRunPipelineClient{PipelineClient: client, plan: c.plan}, nil
+}
+
+// releaseClient creates the release client of the flow, mutating calls are only planned in a dry run
+func (c *MonitorClient) releaseClient(logger logrus.FieldLogger) (releases.ReleaseClient, error) {
+	client, err := c.newReleaseClient(logger)
+	if err != nil || c.plan == nil {
+		return client, err
+	}
+	return &dryRunReleaseClient{ReleaseClient: client, plan: c.plan}, nil
+}
+
+// dryRunPipelineClient reads from azure devops but only plans queueing, tagging and canceling builds
+type dryRunPipelineClient struct {
+	pipelines.PipelineClient
+
+	plan *plan
+}
+
+func (c *dryRunPipelineClient) QueueBuildByBranch(ctx context.Context, pipelineID int, branch string, variables map[string]string, tags []string) (*vstsbuild.Build, error) {
+	c.plan.add("queue build of pipeline %d for branch %s tagged %v", pipelineID, branch, tags)
+	return dryRunBuild(), nil
+}
+
+func (c *dryRunPipelineClient) QueueBuildByCommit(ctx context.Context, pipelineID int, gitCommit string, variables map[string]string, tags []string) (*vstsbuild.Build, error) {
+	c.plan.add("queue build of pipeline %d for commit %s tagged %v", pipelineID, gitCommit, tags)
+	return dryRunBuild(), nil
+}
+
+func (c *dryRunPipelineClient) AddBuildTags(ctx context.Context, buildID int, tags []string) error {
+	return nil
+}
+
+func (c *dryRunPipelineClient) CancelBuild(ctx context.Context, buildID int) error {
+	c.plan.add("cancel build %d", buildID)
+	return nil
+}
+
+func dryRunBuild() *vstsbuild.Build {
+	id := 0
+	uri := dryRunBuildURI
+	number := "dry-run"
+	return &vstsbuild.Build{
+		Id:          &id,
+		Uri:         &uri,
+		BuildNumber: &number,
+	}
+}
+
+// dryRunReleaseClient reads from azure devops but only plans creating releases and acting on their environments
+type dryRunReleaseClient struct {
+	releases.ReleaseClient
+
+	plan *plan
+}
+
+func (c *dryRunReleaseClient) CreateRelease(ctx context.Context, definitionID int, alias string, buildID string, buildNumber string, description string) (*vstsrelease.Release, error) {
+	c.plan.add("create release of definition %d with build %s (%s) as %s", definitionID, buildID, buildNumber, alias)
+	id := 0
+	name := "dry-run"
+	return &vstsrelease.Release{
+		Id:   &id,
+		Name: &name,
+	}, nil
+}
+
+func (c *dryRunReleaseClient) CancelReleaseEnvironment(ctx context.Context, releaseID int, environmentID int, comment string) error {
+	c.plan.add("cancel environment %d of release %d: %s", environmentID, releaseID, comment)
+	return nil
+}
+
+func (c *dryRunReleaseClient) DeployReleaseEnvironment(ctx context.Context, releaseID int, environmentID int, comment string) error {
+	c.plan.add("deploy environment %d of release %d: %s", environmentID, releaseID, comment)
+	return nil
+}
+
+func (c *dryRunReleaseClient) ApproveRelease(ctx context.Context, approvalID int, comment string) error {
+	c.plan.add("approve approval %d: %s", approvalID, comment)
+	return nil
+}
+
+func (c *dryRunReleaseClient) UpdateManualIntervention(ctx context.Context, releaseID int, interventionID int, status vstsrelease.ManualInterventionStatus, comment string) (*vstsrelease.ManualIntervention, error) {
+	c.plan.add("update manual intervention %d of release %d to %s: %s", interventionID, releaseID, status, comment)
+	return &vstsrelease.ManualIntervention{Id: &interventionID, Status: &status, Comments: &comment}, nil
+}
+
+func (c *dryRunReleaseClient) IgnoreGates(ctx context.Context, gateStepID int, gates []string, comment string) error {
+	c.plan.add("ignore gates %v of gate step %d: %s", gates, gateStepID, comment)
+	return nil
+}
+
+// dryRunStateStore reads from the state store but never writes to it
+type dryRunStateStore struct {
+	statestore.StateStore
+}
+
+func (s *dryRunStateStore) PutData(ctx context.Context, key string, data *cicd.Data, version string) (string, error) {
+	return version, nil
+}
+
+// EnableDryRun makes the monitor read the state store and azure devops as usual but only plan
+// what it would write
+func (m *Monitor) EnableDryRun() {
+	m.dryRun = true
+	for _, c := range m.clients {
+		c.plan = &plan{}
+		c.store = &dryRunStateStore{StateStore: c.store}
+	}
+}
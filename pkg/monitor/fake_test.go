@@ -0,0 +1,425 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	vsts "github.com/microsoft/azure-devops-go-api/azuredevops"
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	webapi "github.com/microsoft/azure-devops-go-api/azuredevops/webapi"
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/pipelines"
+	"github.com/yangzuo0621/monitor/pkg/releases"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+// fakePipelineClient serves validation builds and the builds it queued from memory. The methods
+// the monitor isn't expected to call panic through the embedded nil interface.
+type fakePipelineClient struct {
+	pipelines.PipelineClient
+
+	mu sync.Mutex
+
+	// validations are the completed builds of each validation pipeline, newest first
+	validations map[int][]*vstsbuild.Build
+
+	// builds are the builds queued through the client, by id
+	builds map[int]*vstsbuild.Build
+	nextID int
+
+	// issues are the messages of the timeline issues of each build
+	issues map[int][]string
+
+	// unreachable fails GetPipelineByID as if azure devops couldn't be reached
+	unreachable bool
+
+	queued   []string
+	canceled []int
+}
+
+func newFakePipelineClient() *fakePipelineClient {
+	return &fakePipelineClient{
+		validations: map[int][]*vstsbuild.Build{},
+		builds:      map[int]*vstsbuild.Build{},
+		issues:      map[int][]string{},
+		nextID:      100,
+	}
+}
+
+// validate records a succeeded build of pipelineID validating commit
+func (c *fakePipelineClient) validate(pipelineID int, commit string) {
+	c.finish(pipelineID, commit, vstsbuild.BuildResultValues.Succeeded)
+}
+
+// finish records a completed build of pipelineID for commit with result
+func (c *fakePipelineClient) finish(pipelineID int, commit string, result vstsbuild.BuildResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextID
+	c.nextID++
+	number := fmt.Sprintf("validation.%d", id)
+	c.validations[pipelineID] = append([]*vstsbuild.Build{{
+		Id:            &id,
+		BuildNumber:   &number,
+		Result:        &result,
+		SourceVersion: &commit,
+		FinishTime:    &vsts.Time{Time: time.Now().UTC()},
+	}}, c.validations[pipelineID]...)
+}
+
+// pipelineOf returns the validation pipeline of the build id
+func (c *fakePipelineClient) pipelineOf(id int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pipelineID, builds := range c.validations {
+		for _, b := range builds {
+			if *b.Id == id {
+				return pipelineID
+			}
+		}
+	}
+	return 0
+}
+
+// complete finishes the build id with result
+func (c *fakePipelineClient) complete(id int, result vstsbuild.BuildResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := vstsbuild.BuildStatusValues.Completed
+	c.builds[id].Status = &status
+	c.builds[id].Result = &result
+	c.builds[id].FinishTime = &vsts.Time{Time: time.Now().UTC()}
+}
+
+func (c *fakePipelineClient) GetPipelineByID(ctx context.Context, id int) (*vstsbuild.BuildDefinition, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.unreachable {
+		return nil, fmt.Errorf("dial tcp: connection refused")
+	}
+	return &vstsbuild.BuildDefinition{Id: &id}, nil
+}
+
+func (c *fakePipelineClient) ListCompletedBuilds(ctx context.Context, pipelineID int, branch string, minTime time.Time, maxTime time.Time) ([]*vstsbuild.Build, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*vstsbuild.Build(nil), c.validations[pipelineID]...), nil
+}
+
+func (c *fakePipelineClient) GetPipelineBuildByID(ctx context.Context, id int) (*vstsbuild.Build, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b, ok := c.builds[id]
+	if !ok {
+		return nil, fmt.Errorf("build %d not found", id)
+	}
+	copied := *b
+	return &copied, nil
+}
+
+func (c *fakePipelineClient) queue(pipelineID int, source string, tags []string) *vstsbuild.Build {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextID
+	c.nextID++
+	status := vstsbuild.BuildStatusValues.InProgress
+	number := fmt.Sprintf("build.%d", id)
+	uri := fmt.Sprintf("vstfs:///Build/Build/%d", id)
+	b := &vstsbuild.Build{
+		Id:          &id,
+		BuildNumber: &number,
+		Uri:         &uri,
+		Status:      &status,
+		Tags:        &tags,
+		QueueTime:   &vsts.Time{Time: time.Now().UTC()},
+		Definition:  &vstsbuild.DefinitionReference{Id: &pipelineID},
+	}
+	c.builds[id] = b
+	c.queued = append(c.queued, source)
+	copied := *b
+	return &copied
+}
+
+func (c *fakePipelineClient) QueueBuildByBranch(ctx context.Context, pipelineID int, branch string, variables map[string]string, tags []string) (*vstsbuild.Build, error) {
+	return c.queue(pipelineID, branch, tags), nil
+}
+
+func (c *fakePipelineClient) QueueBuildByCommit(ctx context.Context, pipelineID int, gitCommit string, variables map[string]string, tags []string) (*vstsbuild.Build, error) {
+	return c.queue(pipelineID, gitCommit, tags), nil
+}
+
+func (c *fakePipelineClient) AddBuildTags(ctx context.Context, buildID int, tags []string) error {
+	return nil
+}
+
+func (c *fakePipelineClient) ListBuildsByTag(ctx context.Context, pipelineID int, tag string, minTime time.Time) ([]*vstsbuild.Build, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var result []*vstsbuild.Build
+	for _, b := range c.builds {
+		if *b.Definition.Id != pipelineID || b.QueueTime.Time.Before(minTime) {
+			continue
+		}
+		for _, t := range *b.Tags {
+			if t == tag {
+				copied := *b
+				result = append(result, &copied)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (c *fakePipelineClient) CancelBuild(ctx context.Context, buildID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.canceled = append(c.canceled, buildID)
+	return nil
+}
+
+func (c *fakePipelineClient) GetBuildTimeline(ctx context.Context, buildID int) (*vstsbuild.Timeline, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var issues []vstsbuild.Issue
+	for _, m := range c.issues[buildID] {
+		message := m
+		issues = append(issues, vstsbuild.Issue{Message: &message})
+	}
+	return &vstsbuild.Timeline{Records: &[]vstsbuild.TimelineRecord{{Issues: &issues}}}, nil
+}
+
+// fakeReleaseClient keeps the releases it created in memory
+type fakeReleaseClient struct {
+	mu sync.Mutex
+
+	releases map[int]*vstsrelease.Release
+
+	// stagings are the environments of the releases of each definition
+	stagings map[int][]string
+
+	nextID int
+
+	interventions []*vstsrelease.ManualIntervention
+
+	// approver is the identity the fake acts as when updating manual interventions
+	approver string
+
+	// createErrors are the number of times CreateRelease still fails for each definition
+	createErrors map[int]int
+
+	created  []string
+	deployed []int
+	updates  []string
+}
+
+func newFakeReleaseClient() *fakeReleaseClient {
+	return &fakeReleaseClient{
+		releases:     map[int]*vstsrelease.Release{},
+		stagings:     map[int][]string{},
+		createErrors: map[int]int{},
+		nextID:       1000,
+	}
+}
+
+// setStaging sets the status of the environment named name of release id
+func (c *fakeReleaseClient) setStaging(id int, name string, status vstsrelease.EnvironmentStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, e := range *c.releases[id].Environments {
+		if *e.Name == name {
+			(*c.releases[id].Environments)[i].Status = &status
+		}
+	}
+}
+
+func (c *fakeReleaseClient) GetReleaseByID(ctx context.Context, releaseID int) (*vstsrelease.Release, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.releases[releaseID]
+	if !ok {
+		return nil, fmt.Errorf("release %d not found", releaseID)
+	}
+	copied := *r
+	environments := append([]vstsrelease.ReleaseEnvironment(nil), *r.Environments...)
+	copied.Environments = &environments
+	return &copied, nil
+}
+
+func (c *fakeReleaseClient) ListReleases(ctx context.Context, releaseIDs []int) ([]*vstsrelease.Release, error) {
+	var result []*vstsrelease.Release
+	for _, id := range releaseIDs {
+		r, err := c.GetReleaseByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+func (c *fakeReleaseClient) CreateRelease(ctx context.Context, definitionID int, alias string, buildID string, buildNumber string, description string) (*vstsrelease.Release, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.createErrors[definitionID] > 0 {
+		c.createErrors[definitionID]--
+		return nil, fmt.Errorf("create release of definition %d: service unavailable", definitionID)
+	}
+	id := c.nextID
+	c.nextID++
+	name := fmt.Sprintf("Release-%d", id)
+	var environments []vstsrelease.ReleaseEnvironment
+	for i, s := range c.stagings[definitionID] {
+		envID := id*10 + i
+		envName := s
+		status := vstsrelease.EnvironmentStatusValues.InProgress
+		environments = append(environments, vstsrelease.ReleaseEnvironment{Id: &envID, Name: &envName, Status: &status})
+	}
+	r := &vstsrelease.Release{
+		Id:                &id,
+		Name:              &name,
+		Description:       &description,
+		CreatedOn:         &vsts.Time{Time: time.Now().UTC()},
+		ReleaseDefinition: &vstsrelease.ReleaseDefinitionShallowReference{Id: &definitionID},
+		Environments:      &environments,
+	}
+	c.releases[id] = r
+	c.created = append(c.created, description)
+	return r, nil
+}
+
+func (c *fakeReleaseClient) ListReleasesByDefinition(ctx context.Context, definitionID int, minCreatedTime time.Time) ([]*vstsrelease.Release, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var result []*vstsrelease.Release
+	for _, r := range c.releases {
+		if *r.ReleaseDefinition.Id == definitionID && !r.CreatedOn.Time.Before(minCreatedTime) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+func (c *fakeReleaseClient) CancelReleaseEnvironment(ctx context.Context, releaseID int, environmentID int, comment string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updates = append(c.updates, fmt.Sprintf("cancel %d/%d", releaseID, environmentID))
+	return nil
+}
+
+func (c *fakeReleaseClient) DeployReleaseEnvironment(ctx context.Context, releaseID int, environmentID int, comment string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deployed = append(c.deployed, environmentID)
+	if r, ok := c.releases[releaseID]; ok {
+		for i, e := range *r.Environments {
+			if *e.Id == environmentID {
+				status := vstsrelease.EnvironmentStatusValues.InProgress
+				(*r.Environments)[i].Status = &status
+			}
+		}
+	}
+	return nil
+}
+
+func (c *fakeReleaseClient) ApproveRelease(ctx context.Context, approvalID int, comment string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updates = append(c.updates, fmt.Sprintf("approve %d", approvalID))
+	return nil
+}
+
+func (c *fakeReleaseClient) ListManualInterventions(ctx context.Context, releaseID int) ([]*vstsrelease.ManualIntervention, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*vstsrelease.ManualIntervention{}, c.interventions...), nil
+}
+
+func (c *fakeReleaseClient) UpdateManualIntervention(ctx context.Context, releaseID int, interventionID int, status vstsrelease.ManualInterventionStatus, comment string) (*vstsrelease.ManualIntervention, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updates = append(c.updates, fmt.Sprintf("intervention %d %s", interventionID, status))
+	approver := c.approver
+	return &vstsrelease.ManualIntervention{
+		Id:       &interventionID,
+		Status:   &status,
+		Comments: &comment,
+		Approver: &webapi.IdentityRef{UniqueName: &approver},
+	}, nil
+}
+
+func (c *fakeReleaseClient) IgnoreGates(ctx context.Context, gateStepID int, gates []string, comment string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.updates = append(c.updates, fmt.Sprintf("ignore %d %s", gateStepID, strings.Join(gates, ",")))
+	return nil
+}
+
+var _ releases.ReleaseClient = (*fakeReleaseClient)(nil)
+
+// testConfig returns the legacy chain: validation pipeline 1, build pipeline 2 and release
+// definition 10 with staging "canary"
+func testConfig() *FlowConfig {
+	prefix := ""
+	return &FlowConfig{
+		Name:                  "test",
+		MasterValidationE2EID: 1,
+		AksBuildID:            2,
+		AksRelease: []*Release{
+			{DefinitionID: 10, Alias: "aks", Stagings: []string{"canary"}},
+		},
+		BlobPrefix: &prefix,
+	}
+}
+
+// newTestClient creates a MonitorClient of config backed by a memory state store and fake azure
+// devops clients
+func newTestClient(t *testing.T, config *FlowConfig) (*MonitorClient, *fakePipelineClient, *fakeReleaseClient) {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	supervisor := (&Config{}).supervisorConfig()
+	c, err := BuildClient("", config, supervisor, statestore.BuildMemoryStateStore(), logger)
+	if err != nil {
+		t.Fatalf("BuildClient() error = %v", err)
+	}
+
+	pipelineClient := newFakePipelineClient()
+	releaseClient := newFakeReleaseClient()
+	for _, r := range config.AksRelease {
+		releaseClient.stagings[r.DefinitionID] = r.Stagings
+	}
+	c.newPipelineClient = func(logrus.FieldLogger) (pipelines.PipelineClient, error) {
+		return pipelineClient, nil
+	}
+	c.newReleaseClient = func(logrus.FieldLogger) (releases.ReleaseClient, error) {
+		return releaseClient, nil
+	}
+	return c, pipelineClient, releaseClient
+}
+
+// storeEarlierDay stores the data of the day days before date, which ended in state with commit
+func storeEarlierDay(t *testing.T, c *MonitorClient, date string, days int, state cicd.DataState, commit string) {
+	t.Helper()
+	day, err := c.schedule.startOfDay(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	earlier := day.AddDate(0, 0, -days).Format(dateFormat)
+	data := &cicd.Data{
+		Date:             earlier,
+		State:            state,
+		MasterValidation: &cicd.MasterValidation{CommitID: &commit},
+	}
+	if _, err := c.UploadDataToBlob(context.Background(), earlier, data, statestore.VersionAny); err != nil {
+		t.Fatal(err)
+	}
+}
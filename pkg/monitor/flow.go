@@ -0,0 +1,603 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+// StageType is the type of a stage in the flow
+type StageType string
+
+type stageTypeValuesType struct {
+	PickBuild      StageType
+	QueueBuild     StageType
+	CreateRelease  StageType
+	WaitForStaging StageType
+}
+
+var StageTypeValues = stageTypeValuesType{
+	// PickBuild picks the newest succeeded build of a pipeline
+	PickBuild: "pickBuild",
+	// QueueBuild queues a build of a pipeline, for the commit picked by a PickBuild stage or for a branch
+	QueueBuild: "queueBuild",
+	// CreateRelease creates a release of a release definition for the build of a build stage
+	CreateRelease: "createRelease",
+	// WaitForStaging waits until stagings of a release created by a CreateRelease stage succeeded
+	WaitForStaging: "waitForStaging",
+}
+
+// Stage declares a step of the flow, inputs from previous stages are wired by stage name and
+// imply a dependency on that stage
+type Stage struct {
+	Name      string    `json:"name"`
+	Type      StageType `json:"type"`
+	DependsOn []string  `json:"depends_on,omitempty"`
+
+	// PipelineID is the pipeline to pick the build from, or to queue the build of
+	PipelineID int `json:"pipeline_id,omitempty"`
+
+	// Gates are the validation pipelines a picked commit must pass, in addition to PipelineID
+	Gates []*ValidationGate `json:"gates,omitempty"`
+
+	// Commit names the PickBuild stage whose commit is queued, Branch is queued otherwise
+	Commit string `json:"commit,omitempty"`
+	Branch string `json:"branch,omitempty"`
+
+	// DefinitionID and Alias are the release definition and the alias of its build artifact
+	DefinitionID int    `json:"definition_id,omitempty"`
+	Alias        string `json:"source_alias,omitempty"`
+
+	// Build names the stage whose build is released
+	Build string `json:"build,omitempty"`
+
+	// Release names the CreateRelease stage whose Stagings are waited for
+	Release  string   `json:"release,omitempty"`
+	Stagings []string `json:"staging,omitempty"`
+
+	// TimeoutMinutes is the time the build of a QueueBuild stage or each staging of a WaitForStaging
+	// stage may take, the build is canceled or the staging abandoned after it. No timeout if zero.
+	TimeoutMinutes int `json:"timeout_minutes,omitempty"`
+
+	// RetryOnTimeout queues the build of a QueueBuild stage again after a timeout, according to the
+	// retry policy of the build, or deploys the stagings of a WaitForStaging stage again, according
+	// to the retry policy of the releases
+	RetryOnTimeout bool `json:"retry_on_timeout,omitempty"`
+
+	// SoakMinutes is the time a CreateRelease stage waits after its dependencies are done
+	SoakMinutes int `json:"soak_minutes,omitempty"`
+
+	// Deployment drives the stagings of a WaitForStaging stage, the deployment policy of the flow is used if not set
+	Deployment *DeploymentPolicy `json:"deployment,omitempty"`
+}
+
+// inputs returns the names of stages whose output the stage consumes
+func (s *Stage) inputs() []string {
+	var inputs []string
+	for _, v := range []string{s.Commit, s.Build, s.Release} {
+		if v != "" {
+			inputs = append(inputs, v)
+		}
+	}
+	return inputs
+}
+
+// flow is the validated flow of a Config, stages are in topological order
+type flow struct {
+	stages []*Stage
+	byName map[string]*Stage
+
+	// dependencies of each stage, including the stages of its inputs
+	dependencies map[string][]string
+
+	pickBuild  *Stage
+	queueBuild *Stage
+}
+
+// defaultStages converts the legacy master validation -> AKS build -> AKS release chain of config into stages
+func defaultStages(config *FlowConfig) []*Stage {
+	timeouts := TimeoutConfig{}
+	if config.Timeouts != nil {
+		timeouts = *config.Timeouts
+	}
+
+	stages := []*Stage{
+		{
+			Name:       "master-validation",
+			Type:       StageTypeValues.PickBuild,
+			PipelineID: config.MasterValidationE2EID,
+			Gates:      config.MasterValidationGates,
+		},
+		{
+			Name:           "aks-build",
+			Type:           StageTypeValues.QueueBuild,
+			PipelineID:     config.AksBuildID,
+			Commit:         "master-validation",
+			TimeoutMinutes: timeouts.BuildMinutes,
+			RetryOnTimeout: timeouts.RetryBuild,
+		},
+	}
+
+	stagings := map[int]bool{}
+	for _, r := range config.AksRelease {
+		stagings[r.DefinitionID] = len(r.Stagings) > 0
+	}
+
+	for _, r := range config.AksRelease {
+		release := fmt.Sprintf("release-%d", r.DefinitionID)
+		stage := &Stage{
+			Name:         release,
+			Type:         StageTypeValues.CreateRelease,
+			DefinitionID: r.DefinitionID,
+			Alias:        r.Alias,
+			Build:        "aks-build",
+			SoakMinutes:  r.SoakMinutes,
+		}
+		stages = append(stages, stage)
+
+		for _, d := range r.After {
+			dependency := fmt.Sprintf("release-%d", d.DefinitionID)
+			switch {
+			case len(d.Stagings) > 0:
+				// the stagings are waited for by a stage of their own, as they may not be all the
+				// stagings of the release
+				name := fmt.Sprintf("%s-after-%d", release, d.DefinitionID)
+				stages = append(stages, &Stage{
+					Name:     name,
+					Type:     StageTypeValues.WaitForStaging,
+					Release:  dependency,
+					Stagings: d.Stagings,
+				})
+				dependency = name
+			case stagings[d.DefinitionID]:
+				dependency += "-staging"
+			}
+			stage.DependsOn = append(stage.DependsOn, dependency)
+		}
+
+		if len(r.Stagings) > 0 {
+			stages = append(stages, &Stage{
+				Name:           release + "-staging",
+				Type:           StageTypeValues.WaitForStaging,
+				Release:        release,
+				Stagings:       r.Stagings,
+				TimeoutMinutes: timeouts.StagingMinutes,
+				RetryOnTimeout: timeouts.RetryStaging,
+			})
+		}
+	}
+	return stages
+}
+
+// buildFlow validates the stages of config, the legacy chain is used if no stage is declared
+func buildFlow(config *FlowConfig) (*flow, error) {
+	stages := config.Stages
+	if len(stages) == 0 {
+		stages = defaultStages(config)
+	}
+
+	f := &flow{
+		byName:       map[string]*Stage{},
+		dependencies: map[string][]string{},
+	}
+
+	for _, s := range stages {
+		if s.Name == "" {
+			return nil, fmt.Errorf("stage of type %q has no name", s.Type)
+		}
+		if _, ok := f.byName[s.Name]; ok {
+			return nil, fmt.Errorf("stage %q is declared more than once", s.Name)
+		}
+		f.byName[s.Name] = s
+	}
+
+	for _, s := range stages {
+		if err := f.validateStage(s); err != nil {
+			return nil, fmt.Errorf("stage %q: %w", s.Name, err)
+		}
+	}
+
+	if f.pickBuild == nil && f.queueBuild == nil {
+		return nil, fmt.Errorf("flow has neither a %s nor a %s stage", StageTypeValues.PickBuild, StageTypeValues.QueueBuild)
+	}
+
+	ordered, err := f.sort(stages)
+	if err != nil {
+		return nil, err
+	}
+	f.stages = ordered
+	return f, nil
+}
+
+func (f *flow) validateStage(s *Stage) error {
+	deps := append([]string{}, s.DependsOn...)
+	deps = append(deps, s.inputs()...)
+	for _, d := range deps {
+		dep, ok := f.byName[d]
+		if !ok {
+			return fmt.Errorf("depends on unknown stage %q", d)
+		}
+		if isBuildStage(s) && !isBuildStage(dep) {
+			return fmt.Errorf("build stage can't depend on %s stage %q", dep.Type, d)
+		}
+	}
+	f.dependencies[s.Name] = deps
+
+	if s.TimeoutMinutes < 0 {
+		return fmt.Errorf("timeout_minutes must not be negative")
+	}
+	if s.TimeoutMinutes > 0 && s.Type != StageTypeValues.QueueBuild && s.Type != StageTypeValues.WaitForStaging {
+		return fmt.Errorf("timeout_minutes isn't supported by %s stages", s.Type)
+	}
+	if s.RetryOnTimeout && s.Type != StageTypeValues.QueueBuild && s.Type != StageTypeValues.WaitForStaging {
+		return fmt.Errorf("retry_on_timeout isn't supported by %s stages", s.Type)
+	}
+	if s.SoakMinutes < 0 {
+		return fmt.Errorf("soak_minutes must not be negative")
+	}
+	if s.SoakMinutes > 0 && s.Type != StageTypeValues.CreateRelease {
+		return fmt.Errorf("soak_minutes isn't supported by %s stages", s.Type)
+	}
+	if s.Deployment != nil {
+		if s.Type != StageTypeValues.WaitForStaging {
+			return fmt.Errorf("deployment isn't supported by %s stages", s.Type)
+		}
+		if err := s.Deployment.validate(); err != nil {
+			return fmt.Errorf("invalid deployment: %w", err)
+		}
+	}
+
+	switch s.Type {
+	case StageTypeValues.PickBuild:
+		if f.pickBuild != nil {
+			return fmt.Errorf("a flow supports a single %s stage as the day records one commit, %q is already declared", s.Type, f.pickBuild.Name)
+		}
+		gates := s.gates()
+		if len(gates) == 0 {
+			return fmt.Errorf("pipeline_id or gates is required")
+		}
+		for i, g := range gates {
+			if err := g.validate(); err != nil {
+				return fmt.Errorf("gate %d: %w", i, err)
+			}
+		}
+		f.pickBuild = s
+	case StageTypeValues.QueueBuild:
+		if f.queueBuild != nil {
+			return fmt.Errorf("a flow supports a single %s stage as the day records one build, %q is already declared", s.Type, f.queueBuild.Name)
+		}
+		if s.PipelineID == 0 {
+			return fmt.Errorf("pipeline_id is required")
+		}
+		if (s.Commit == "") == (s.Branch == "") {
+			return fmt.Errorf("exactly one of commit and branch is required")
+		}
+		if err := f.expectInput(s.Commit, StageTypeValues.PickBuild); err != nil {
+			return err
+		}
+		f.queueBuild = s
+	case StageTypeValues.CreateRelease:
+		if s.DefinitionID == 0 || s.Alias == "" {
+			return fmt.Errorf("definition_id and source_alias are required")
+		}
+		if s.Build == "" {
+			return fmt.Errorf("build is required")
+		}
+		if err := f.expectInput(s.Build, StageTypeValues.QueueBuild, StageTypeValues.PickBuild); err != nil {
+			return err
+		}
+	case StageTypeValues.WaitForStaging:
+		if s.Release == "" || len(s.Stagings) == 0 {
+			return fmt.Errorf("release and staging are required")
+		}
+		if err := f.expectInput(s.Release, StageTypeValues.CreateRelease); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown stage type %q", s.Type)
+	}
+	return nil
+}
+
+// expectInput checks the stage named input, if set, is of one of types
+func (f *flow) expectInput(input string, types ...StageType) error {
+	if input == "" {
+		return nil
+	}
+	for _, t := range types {
+		if f.byName[input].Type == t {
+			return nil
+		}
+	}
+	return fmt.Errorf("input %q is a %s stage, expects %v", input, f.byName[input].Type, types)
+}
+
+// sort orders stages so that every stage comes after its dependencies, cycles are rejected
+func (f *flow) sort(stages []*Stage) ([]*Stage, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := map[string]int{}
+	var ordered []*Stage
+
+	var visit func(s *Stage, path []string) error
+	visit = func(s *Stage, path []string) error {
+		switch marks[s.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("stages form a cycle: %s", strings.Join(append(path, s.Name), " -> "))
+		}
+		marks[s.Name] = visiting
+		for _, d := range f.dependencies[s.Name] {
+			if err := visit(f.byName[d], append(path, s.Name)); err != nil {
+				return err
+			}
+		}
+		marks[s.Name] = visited
+		ordered = append(ordered, s)
+		return nil
+	}
+
+	for _, s := range stages {
+		if err := visit(s, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// buildStage returns the stage producing the build of the flow, which is the QueueBuild stage if declared
+func (f *flow) buildStage() *Stage {
+	if f.queueBuild != nil {
+		return f.queueBuild
+	}
+	return f.pickBuild
+}
+
+// releaseStages returns the CreateRelease stages in topological order
+func (f *flow) releaseStages() []*Stage {
+	var result []*Stage
+	for _, s := range f.stages {
+		if s.Type == StageTypeValues.CreateRelease {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// newData creates the data of a day which hasn't started yet
+func (f *flow) newData(date string) *cicd.Data {
+	data := &cicd.Data{
+		State: cicd.DataStateValues.None,
+		Date:  date,
+	}
+	if f.pickBuild != nil {
+		data.MasterValidation = &cicd.MasterValidation{
+			ID: f.pickBuild.gates()[0].PipelineID,
+		}
+	}
+
+	for _, r := range f.releaseStages() {
+		release := &cicd.AKSRelease{
+			Stage:        r.Name,
+			DefinitionID: r.DefinitionID,
+			Alias:        r.Alias,
+		}
+		for _, s := range f.stages {
+			if s.Type != StageTypeValues.WaitForStaging || s.Release != r.Name {
+				continue
+			}
+			for _, name := range s.Stagings {
+				release.Staging = append(release.Staging, &cicd.Staging{
+					Stage: s.Name,
+					Name:  name,
+				})
+			}
+		}
+		data.AKSRelease = append(data.AKSRelease, release)
+	}
+	return data
+}
+
+// stageDone checks whether the stage named name finished successfully according to data
+func (f *flow) stageDone(data *cicd.Data, name string) bool {
+	s := f.byName[name]
+	switch s.Type {
+	case StageTypeValues.PickBuild:
+		return data.MasterValidation != nil && data.MasterValidation.CommitID != nil
+	case StageTypeValues.QueueBuild:
+		return data.AKSBuild != nil && data.AKSBuild.BuildResult != nil && *data.AKSBuild.BuildResult == string(vstsbuild.BuildResultValues.Succeeded)
+	case StageTypeValues.CreateRelease:
+		r := findRelease(data, name)
+		return r != nil && r.ReleaseID != nil
+	case StageTypeValues.WaitForStaging:
+		for _, r := range data.AKSRelease {
+			for _, staging := range r.Staging {
+				if staging.Stage != name {
+					continue
+				}
+				if staging.Status == nil || !stagingSucceeded(*staging.Status) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// dependenciesDone checks whether all dependencies of the stage named name finished successfully
+func (f *flow) dependenciesDone(data *cicd.Data, name string) bool {
+	for _, d := range f.dependencies[name] {
+		if !f.stageDone(data, d) {
+			return false
+		}
+	}
+	return true
+}
+
+// dependenciesFinishTime returns when the last dependency of the stage named name finished, nil if
+// unknown
+func (f *flow) dependenciesFinishTime(data *cicd.Data, name string) *time.Time {
+	var finish *time.Time
+	later := func(t *time.Time) {
+		if t != nil && (finish == nil || t.After(*finish)) {
+			finish = t
+		}
+	}
+
+	for _, d := range f.dependencies[name] {
+		switch f.byName[d].Type {
+		case StageTypeValues.PickBuild:
+			if data.MasterValidation != nil {
+				later(data.MasterValidation.FinishTime)
+			}
+		case StageTypeValues.QueueBuild:
+			if data.AKSBuild != nil {
+				later(data.AKSBuild.FinishTime)
+			}
+		case StageTypeValues.CreateRelease:
+			if r := findRelease(data, d); r != nil {
+				later(r.StartTime)
+			}
+		case StageTypeValues.WaitForStaging:
+			for _, r := range data.AKSRelease {
+				for _, staging := range r.Staging {
+					if staging.Stage == d {
+						later(staging.FinishTime)
+					}
+				}
+			}
+		}
+	}
+	return finish
+}
+
+// dependencyFailed checks whether a dependency of the stage named name ended unsuccessfully, so
+// that the stage can never run
+func (f *flow) dependencyFailed(data *cicd.Data, name string) bool {
+	for _, d := range f.dependencies[name] {
+		switch f.byName[d].Type {
+		case StageTypeValues.CreateRelease:
+			if r := findRelease(data, d); r != nil && r.State.IsUnsuccessful() {
+				return true
+			}
+		case StageTypeValues.WaitForStaging:
+			for _, r := range data.AKSRelease {
+				if r.Stage == f.byName[d].Release && r.State.IsUnsuccessful() {
+					return true
+				}
+				for _, staging := range r.Staging {
+					if staging.Stage == d && staging.Status != nil && stagingUnsuccessful(*staging.Status) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// findRelease returns the release of data created by the stage named stage
+func findRelease(data *cicd.Data, stage string) *cicd.AKSRelease {
+	for _, r := range data.AKSRelease {
+		if r.Stage == stage {
+			return r
+		}
+	}
+	return nil
+}
+
+// migrate assigns stages to releases and stagings of data recorded before stages were declared, and
+// adds the stagings of stages declared since
+func (f *flow) migrate(data *cicd.Data) {
+	for _, r := range data.AKSRelease {
+		if r.Stage != "" {
+			continue
+		}
+		for _, s := range f.releaseStages() {
+			if s.DefinitionID == r.DefinitionID && findRelease(data, s.Name) == nil {
+				r.Stage = s.Name
+				break
+			}
+		}
+	}
+
+	for _, r := range data.AKSRelease {
+		for _, staging := range r.Staging {
+			if staging.Stage != "" {
+				continue
+			}
+			for _, s := range f.stages {
+				if s.Type == StageTypeValues.WaitForStaging && s.Release == r.Stage && containsFold(s.Stagings, staging.Name) {
+					staging.Stage = s.Name
+					break
+				}
+			}
+		}
+	}
+
+	// stagings of stages declared since the data was recorded, their status is read by the next cycle
+	for _, s := range f.stages {
+		if s.Type != StageTypeValues.WaitForStaging {
+			continue
+		}
+		r := findRelease(data, s.Release)
+		if r == nil {
+			continue
+		}
+		for _, name := range s.Stagings {
+			if findStaging(r, s.Name, name) == nil {
+				r.Staging = append(r.Staging, &cicd.Staging{
+					Stage: s.Name,
+					Name:  name,
+				})
+			}
+		}
+	}
+}
+
+// findStaging returns the staging named name of release waited for by the stage named stage
+func findStaging(release *cicd.AKSRelease, stage string, name string) *cicd.Staging {
+	for _, staging := range release.Staging {
+		if staging.Stage == stage && strings.EqualFold(staging.Name, name) {
+			return staging
+		}
+	}
+	return nil
+}
+
+func stagingUnsuccessful(status string) bool {
+	switch status {
+	case cicd.StagingStatusFailed, cicd.StagingStatusTimedOut,
+		string(vstsrelease.EnvironmentStatusValues.Rejected),
+		string(vstsrelease.EnvironmentStatusValues.Canceled):
+		return true
+	}
+	return false
+}
+
+func stagingSucceeded(status string) bool {
+	return status == string(vstsrelease.EnvironmentStatusValues.Succeeded) ||
+		status == string(vstsrelease.EnvironmentStatusValues.PartiallySucceeded)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func isBuildStage(s *Stage) bool {
+	return s.Type == StageTypeValues.PickBuild || s.Type == StageTypeValues.QueueBuild
+}
@@ -0,0 +1,182 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildFlowLegacyChain(t *testing.T) {
+	config := testConfig()
+	config.AksRelease = []*Release{
+		{DefinitionID: 10, Alias: "aks", Stagings: []string{"canary"}},
+		{DefinitionID: 11, Alias: "aks", Stagings: []string{"prod"}, After: []*ReleaseDependency{{DefinitionID: 10}}},
+		{DefinitionID: 12, Alias: "aks", After: []*ReleaseDependency{{DefinitionID: 11, Stagings: []string{"prod"}}}},
+	}
+
+	f, err := buildFlow(config)
+	if err != nil {
+		t.Fatalf("buildFlow() error = %v", err)
+	}
+
+	want := map[string][]string{
+		"aks-build":           {"master-validation"},
+		"release-10":          {"aks-build"},
+		"release-11":          {"release-10-staging", "aks-build"},
+		"release-12":          {"release-12-after-11", "aks-build"},
+		"release-12-after-11": {"release-11"},
+		"release-10-staging":  {"release-10"},
+		"release-11-staging":  {"release-11"},
+		"master-validation":   nil,
+	}
+	for name, deps := range want {
+		if got := f.dependencies[name]; strings.Join(got, ",") != strings.Join(deps, ",") {
+			t.Errorf("dependencies of %s = %v, want %v", name, got, deps)
+		}
+	}
+	assertTopological(t, f)
+}
+
+func TestFlowSort(t *testing.T) {
+	stages := []*Stage{
+		{Name: "wait-b", Type: StageTypeValues.WaitForStaging, Release: "release-b", Stagings: []string{"s"}},
+		{Name: "release-b", Type: StageTypeValues.CreateRelease, DefinitionID: 2, Alias: "a", Build: "build", DependsOn: []string{"wait-a"}},
+		{Name: "wait-a", Type: StageTypeValues.WaitForStaging, Release: "release-a", Stagings: []string{"s"}},
+		{Name: "release-a", Type: StageTypeValues.CreateRelease, DefinitionID: 1, Alias: "a", Build: "build"},
+		{Name: "build", Type: StageTypeValues.QueueBuild, PipelineID: 2, Commit: "pick"},
+		{Name: "pick", Type: StageTypeValues.PickBuild, PipelineID: 1},
+	}
+
+	f, err := buildFlow(&FlowConfig{Stages: stages})
+	if err != nil {
+		t.Fatalf("buildFlow() error = %v", err)
+	}
+	if len(f.stages) != len(stages) {
+		t.Fatalf("sorted %d stages, want %d", len(f.stages), len(stages))
+	}
+	assertTopological(t, f)
+
+	var releases []string
+	for _, s := range f.releaseStages() {
+		releases = append(releases, s.Name)
+	}
+	if strings.Join(releases, ",") != "release-a,release-b" {
+		t.Errorf("releaseStages() = %v, want release-a before release-b", releases)
+	}
+}
+
+// assertTopological checks every stage of f comes after its dependencies
+func assertTopological(t *testing.T, f *flow) {
+	t.Helper()
+	position := map[string]int{}
+	for i, s := range f.stages {
+		position[s.Name] = i
+	}
+	for _, s := range f.stages {
+		for _, d := range f.dependencies[s.Name] {
+			if position[d] > position[s.Name] {
+				t.Errorf("stage %s is ordered before its dependency %s", s.Name, d)
+			}
+		}
+	}
+}
+
+func TestBuildFlowValidation(t *testing.T) {
+	pick := &Stage{Name: "pick", Type: StageTypeValues.PickBuild, PipelineID: 1}
+	build := &Stage{Name: "build", Type: StageTypeValues.QueueBuild, PipelineID: 2, Commit: "pick"}
+	release := &Stage{Name: "release", Type: StageTypeValues.CreateRelease, DefinitionID: 10, Alias: "a", Build: "build"}
+
+	tests := []struct {
+		name    string
+		stages  []*Stage
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			stages: []*Stage{pick, build, release},
+		},
+		{
+			name:    "no build stage",
+			stages:  []*Stage{{Name: "wait", Type: StageTypeValues.WaitForStaging, Release: "release", Stagings: []string{"s"}}, release},
+			wantErr: "unknown stage",
+		},
+		{
+			name:    "unnamed stage",
+			stages:  []*Stage{{Type: StageTypeValues.PickBuild, PipelineID: 1}},
+			wantErr: "has no name",
+		},
+		{
+			name:    "duplicate stage",
+			stages:  []*Stage{pick, pick},
+			wantErr: "declared more than once",
+		},
+		{
+			name:    "second pickBuild stage",
+			stages:  []*Stage{pick, {Name: "pick-2", Type: StageTypeValues.PickBuild, PipelineID: 3}},
+			wantErr: "a flow supports a single pickBuild stage as the day records one commit, \"pick\" is already declared",
+		},
+		{
+			name:    "second queueBuild stage",
+			stages:  []*Stage{pick, build, {Name: "build-2", Type: StageTypeValues.QueueBuild, PipelineID: 4, Commit: "pick"}},
+			wantErr: "a flow supports a single queueBuild stage as the day records one build, \"build\" is already declared",
+		},
+		{
+			name:    "unknown dependency",
+			stages:  []*Stage{pick, {Name: "build", Type: StageTypeValues.QueueBuild, PipelineID: 2, Branch: "master", DependsOn: []string{"missing"}}},
+			wantErr: "unknown stage \"missing\"",
+		},
+		{
+			name:    "build depends on release",
+			stages:  []*Stage{pick, {Name: "build", Type: StageTypeValues.QueueBuild, PipelineID: 2, Commit: "pick", DependsOn: []string{"release"}}, release},
+			wantErr: "build stage can't depend",
+		},
+		{
+			name: "cycle",
+			stages: []*Stage{
+				pick,
+				{Name: "r1", Type: StageTypeValues.CreateRelease, DefinitionID: 1, Alias: "a", Build: "pick", DependsOn: []string{"r2"}},
+				{Name: "r2", Type: StageTypeValues.CreateRelease, DefinitionID: 2, Alias: "a", Build: "pick", DependsOn: []string{"r1"}},
+			},
+			wantErr: "cycle",
+		},
+		{
+			name:    "wrong input type",
+			stages:  []*Stage{pick, build, {Name: "release", Type: StageTypeValues.CreateRelease, DefinitionID: 10, Alias: "a", Build: "other"}, {Name: "other", Type: StageTypeValues.WaitForStaging, Release: "release", Stagings: []string{"s"}}},
+			wantErr: "is a waitForStaging stage",
+		},
+		{
+			name:    "commit and branch",
+			stages:  []*Stage{pick, {Name: "build", Type: StageTypeValues.QueueBuild, PipelineID: 2, Commit: "pick", Branch: "master"}},
+			wantErr: "exactly one of commit and branch",
+		},
+		{
+			name:    "timeout of a release",
+			stages:  []*Stage{pick, {Name: "release", Type: StageTypeValues.CreateRelease, DefinitionID: 10, Alias: "a", Build: "pick", TimeoutMinutes: 5}},
+			wantErr: "timeout_minutes isn't supported",
+		},
+		{
+			name:    "soak of a build",
+			stages:  []*Stage{{Name: "pick", Type: StageTypeValues.PickBuild, PipelineID: 1, SoakMinutes: 5}},
+			wantErr: "soak_minutes isn't supported",
+		},
+		{
+			name:    "unknown type",
+			stages:  []*Stage{pick, {Name: "deploy", Type: "deploy"}},
+			wantErr: "unknown stage type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildFlow(&FlowConfig{Stages: tt.stages})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("buildFlow() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("buildFlow() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
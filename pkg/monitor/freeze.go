@@ -0,0 +1,129 @@
+package monitor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/calendar"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+// FreezeConfig declares when no new build or release is started, what is already in flight is
+// still monitored
+type FreezeConfig struct {
+	// Weekdays are blackout days of the week in the timezone of the schedule, e.g. ["saturday", "sunday"]
+	Weekdays []string `json:"weekdays,omitempty"`
+
+	// Windows are freeze windows declared inline
+	Windows []*FreezeWindow `json:"windows,omitempty"`
+
+	// ICSFile is an iCalendar file whose events are freeze windows, it is read again when modified
+	ICSFile string `json:"ics_file,omitempty"`
+}
+
+// FreezeWindow is a range of time, Start and End are either dates 2006-01-02 in the timezone of the
+// schedule, End included, or RFC3339 times, End excluded
+type FreezeWindow struct {
+	Name  string `json:"name"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// buildFreezeCalendar parses the freeze calendar of config, nil is returned if not set
+func buildFreezeCalendar(config *FreezeConfig, location *time.Location) (*calendar.Calendar, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	var weekdays []time.Weekday
+	for _, name := range config.Weekdays {
+		day, err := parseWeekday(name)
+		if err != nil {
+			return nil, err
+		}
+		weekdays = append(weekdays, day)
+	}
+
+	var events []*calendar.Event
+	for i, w := range config.Windows {
+		start, _, err := parseFreezeTime(w.Start, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start of window %d: %w", i, err)
+		}
+		end, date, err := parseFreezeTime(w.End, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end of window %d: %w", i, err)
+		}
+		if date {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !start.Before(end) {
+			return nil, fmt.Errorf("window %d ends before it starts", i)
+		}
+
+		name := w.Name
+		if name == "" {
+			name = fmt.Sprintf("freeze %s - %s", w.Start, w.End)
+		}
+		events = append(events, &calendar.Event{Summary: name, Start: start, End: end})
+	}
+
+	return calendar.New(location, weekdays, events, config.ICSFile), nil
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), name) || strings.EqualFold(d.String()[:3], name) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday %q", name)
+}
+
+// parseFreezeTime parses a date or an RFC3339 time, true is returned for dates
+func parseFreezeTime(value string, location *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(dateFormat, value, location); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+// frozen checks whether nothing may be started for the day of data at now because of a freeze, the
+// reason of the freeze is returned. A freeze an operator overrode for the day is ignored.
+func (c *MonitorClient) frozen(data *cicd.Data, now time.Time, logger logrus.FieldLogger) (string, bool, error) {
+	reason, frozen, err := c.freeze.Blackout(now)
+	if err != nil {
+		return "", false, err
+	}
+	if !frozen {
+		return "", false, nil
+	}
+	if data.FreezeOverride {
+		logger.Infof("freeze %q is overridden for %s", reason, data.Date)
+		return "", false, nil
+	}
+	return reason, true, nil
+}
+
+// skipForFreeze checks whether nothing may be started at now because of a freeze. The day moves to
+// SkippedFreeze if so, unless an operator overrode the freeze of the day.
+func (c *MonitorClient) skipForFreeze(data *cicd.Data, now time.Time, logger logrus.FieldLogger) (bool, error) {
+	reason, frozen, err := c.frozen(data, now, logger)
+	if err != nil || !frozen {
+		return false, err
+	}
+
+	c.plan.add("skip %s for freeze %q", data.Date, reason)
+	data.Freeze = &cicd.Freeze{
+		Reason: reason,
+		Time:   now.UTC(),
+	}
+	if err := data.TransitionTo(cicd.DataStateValues.SkippedFreeze, "freeze: "+reason); err != nil {
+		return false, err
+	}
+	logger.Infof("%s is skipped for freeze %q", data.Date, reason)
+	return true, nil
+}
@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+// frozenConfig returns the test config frozen every day
+func frozenConfig() *FlowConfig {
+	config := testConfig()
+	config.Freeze = &FreezeConfig{
+		Weekdays: []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"},
+	}
+	return config
+}
+
+func TestFreezeDuringBuildRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		override   bool
+		wantState  cicd.DataState
+		wantQueued int
+	}{
+		{name: "retry waits for the freeze", wantState: cicd.DataStateValues.BuildFailed, wantQueued: 1},
+		{name: "retry of overridden freeze", override: true, wantState: cicd.DataStateValues.NotStart, wantQueued: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, pipelineClient, _ := newTestClient(t, frozenConfig())
+			ctx := context.Background()
+			date := c.Today()
+
+			failed := pipelineClient.queue(2, "abc123", []string{c.buildCorrelationID(&cicd.Data{Date: date}, 1)})
+			pipelineClient.complete(*failed.Id, vstsbuild.BuildResultValues.Failed)
+			pipelineClient.validate(1, "abc123")
+
+			retryAfter, commit := time.Now().Add(-time.Minute), "abc123"
+			data := c.flow.newData(date)
+			data.MasterValidation.CommitID = &commit
+			data.State = cicd.DataStateValues.BuildFailed
+			data.FreezeOverride = tt.override
+			data.AKSBuild = &cicd.AKSBuild{ID: *failed.Id, Count: 1, TimedOut: true, RetryAfter: &retryAfter}
+			if _, err := c.UploadDataToBlob(ctx, date, data, statestore.VersionAny); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := c.reconcile(ctx)
+			if err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+			if data.State != tt.wantState {
+				t.Errorf("state = %s, want %s", data.State, tt.wantState)
+			}
+			if len(pipelineClient.queued) != tt.wantQueued {
+				t.Errorf("queued %d builds, want %d", len(pipelineClient.queued), tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestFreezeStopsReleaseCreation(t *testing.T) {
+	c, _, releaseClient := newTestClient(t, frozenConfig())
+	buildNumber, result := "20210301.1", string(vstsbuild.BuildResultValues.Succeeded)
+	data := c.flow.newData(c.Today())
+	data.State = cicd.DataStateValues.ReleaseInProgress
+	data.AKSBuild = &cicd.AKSBuild{ID: 5, Count: 1, BuildNumber: &buildNumber, BuildResult: &result}
+
+	if err := c.createReleases(context.Background(), releaseClient, data); err != nil {
+		t.Fatalf("createReleases() error = %v", err)
+	}
+	if len(releaseClient.created) != 0 {
+		t.Errorf("created %d releases during the freeze", len(releaseClient.created))
+	}
+
+	data.FreezeOverride = true
+	if err := c.createReleases(context.Background(), releaseClient, data); err != nil {
+		t.Fatalf("createReleases() error = %v", err)
+	}
+	if len(releaseClient.created) != 1 {
+		t.Errorf("created %d releases with the freeze overridden, want 1", len(releaseClient.created))
+	}
+}
+
+// TestFreezeHoldsSucceededBuild checks a build which succeeded before a freeze is released once the freeze is over
+func TestFreezeHoldsSucceededBuild(t *testing.T) {
+	c, pipelineClient, releaseClient := newTestClient(t, testConfig())
+	ctx := context.Background()
+	pipelineClient.validate(1, "abc123")
+
+	var data *cicd.Data
+	reconcile := func(want cicd.DataState) {
+		t.Helper()
+		var err error
+		if data, err = c.reconcile(ctx); err != nil {
+			t.Fatalf("reconcile() error = %v", err)
+		}
+		if data.State != want {
+			t.Fatalf("state = %s, want %s", data.State, want)
+		}
+	}
+	reconcile(cicd.DataStateValues.NotStart)
+	reconcile(cicd.DataStateValues.BuildInProgress)
+	pipelineClient.complete(data.AKSBuild.ID, vstsbuild.BuildResultValues.Succeeded)
+	reconcile(cicd.DataStateValues.BuildSucceeded)
+
+	freeze, err := buildFreezeCalendar(frozenConfig().Freeze, c.schedule.location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.freeze = freeze
+	reconcile(cicd.DataStateValues.BuildSucceeded)
+	if len(releaseClient.created) != 0 {
+		t.Errorf("created %d releases during the freeze", len(releaseClient.created))
+	}
+
+	c.freeze = nil
+	reconcile(cicd.DataStateValues.ReleaseInProgress)
+	if len(releaseClient.created) != 1 {
+		t.Errorf("created %d releases once the freeze was over, want 1", len(releaseClient.created))
+	}
+}
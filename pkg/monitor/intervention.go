@@ -0,0 +1,325 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/releases"
+)
+
+// intervention rule kinds and actions
+const (
+	// InterventionKindManual matches the manual intervention tasks of the stagings
+	InterventionKindManual = cicd.StagingWaitingForIntervention
+	// InterventionKindGates matches the gates of the stagings
+	InterventionKindGates = cicd.StagingWaitingForGates
+
+	// InterventionActionResume resumes a manual intervention or ignores gates
+	InterventionActionResume = "resume"
+	// InterventionActionReject rejects a manual intervention or abandons the staging evaluating gates
+	InterventionActionReject = "reject"
+)
+
+// InterventionRule resumes or rejects the manual interventions or gates a staging waits for
+type InterventionRule struct {
+	// Kind is manualIntervention or gates
+	Kind string `json:"kind"`
+
+	// Name is a case-insensitive pattern of the names of the manual interventions or gates the rule
+	// applies to, all of them if empty
+	Name string `json:"name,omitempty"`
+
+	// Action is resume or reject
+	Action string `json:"action"`
+
+	// AfterMinutes leaves people time to act before the monitor does, from the creation of the manual
+	// intervention or the start of the gate evaluation
+	AfterMinutes int `json:"after_minutes,omitempty"`
+}
+
+func (r *InterventionRule) validate() error {
+	switch r.Kind {
+	case InterventionKindManual, InterventionKindGates:
+	default:
+		return fmt.Errorf("unknown intervention kind %q", r.Kind)
+	}
+	switch r.Action {
+	case InterventionActionResume, InterventionActionReject:
+	default:
+		return fmt.Errorf("unknown intervention action %q", r.Action)
+	}
+	if _, err := path.Match(strings.ToLower(r.Name), ""); err != nil {
+		return fmt.Errorf("invalid intervention name %q: %w", r.Name, err)
+	}
+	if r.AfterMinutes < 0 {
+		return fmt.Errorf("after_minutes must not be negative")
+	}
+	return nil
+}
+
+func (r *InterventionRule) matches(kind string, name string) bool {
+	if r.Kind != kind {
+		return false
+	}
+	if r.Name == "" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(r.Name), strings.ToLower(name))
+	return ok
+}
+
+// deadline returns when the rule acts on what started at start, nil if start is unknown
+func (r *InterventionRule) deadline(start *time.Time) *time.Time {
+	if start == nil {
+		return nil
+	}
+	deadline := start.Add(time.Duration(r.AfterMinutes) * time.Minute)
+	return &deadline
+}
+
+// interventionRule returns the first rule of policy matching the manual intervention or gate, nil if none
+func interventionRule(policy *DeploymentPolicy, kind string, name string) *InterventionRule {
+	if policy == nil {
+		return nil
+	}
+	for _, r := range policy.Interventions {
+		if r.matches(kind, name) {
+			return r
+		}
+	}
+	return nil
+}
+
+// stagingRunning checks whether the staging status is one of a deployment not finished yet
+func stagingRunning(status string) bool {
+	switch status {
+	case "inProgress", "queued", "scheduled":
+		return true
+	}
+	return false
+}
+
+// listInterventions lists the manual interventions of release if any of its environments is
+// running, none can be pending otherwise
+func listInterventions(
+	ctx context.Context,
+	releaseClient releases.ReleaseClient,
+	release *vstsrelease.Release,
+) ([]*vstsrelease.ManualIntervention, error) {
+	if release.Environments == nil || release.Id == nil {
+		return nil, nil
+	}
+	for _, e := range *release.Environments {
+		if e.Status != nil && stagingRunning(string(*e.Status)) {
+			return releaseClient.ListManualInterventions(ctx, *release.Id)
+		}
+	}
+	return nil, nil
+}
+
+// recordInterventions records in staging the manual interventions of environment and the gate
+// evaluations of its latest deployment, and what the staging waits for
+func recordInterventions(
+	staging *cicd.Staging,
+	environment *vstsrelease.ReleaseEnvironment,
+	interventions []*vstsrelease.ManualIntervention,
+	policy *DeploymentPolicy,
+) {
+	staging.WaitingFor = ""
+	if staging.Status == nil || !stagingRunning(*staging.Status) {
+		return
+	}
+
+	var records []*cicd.Intervention
+	for _, mi := range interventions {
+		if mi.Id == nil || mi.ReleaseEnvironment == nil || mi.ReleaseEnvironment.Id == nil ||
+			environment.Id == nil || *mi.ReleaseEnvironment.Id != *environment.Id {
+			continue
+		}
+		record := &cicd.Intervention{
+			ID:           *mi.Id,
+			Name:         stringValue(mi.Name),
+			Instructions: stringValue(mi.Instructions),
+			CreatedAt:    timeOf(mi.CreatedOn),
+			Comment:      stringValue(mi.Comments),
+		}
+		if mi.Status != nil {
+			record.Status = string(*mi.Status)
+		}
+		if record.Status == string(vstsrelease.ManualInterventionStatusValues.Pending) {
+			if rule := interventionRule(policy, InterventionKindManual, record.Name); rule != nil {
+				record.Deadline = rule.deadline(record.CreatedAt)
+			}
+			staging.WaitingFor = cicd.StagingWaitingForIntervention
+		} else {
+			record.ResolvedBy = identityName(mi.Approver)
+		}
+		records = append(records, record)
+	}
+	if interventions != nil {
+		// the recorded interventions are kept if they couldn't be listed
+		staging.Interventions = records
+	}
+
+	staging.Gates = nil
+	if latest := latestDeployStep(environment); latest != nil {
+		for _, g := range []struct {
+			phase    string
+			gates    *vstsrelease.ReleaseGates
+			snapshot *vstsrelease.ReleaseDefinitionGatesStep
+		}{
+			{cicd.GatePhasePreDeployment, latest.PreDeploymentGates, environment.PreDeploymentGatesSnapshot},
+			{cicd.GatePhasePostDeployment, latest.PostDeploymentGates, environment.PostDeploymentGatesSnapshot},
+		} {
+			if evaluation := gateEvaluation(g.phase, g.gates, g.snapshot); evaluation != nil {
+				staging.Gates = append(staging.Gates, evaluation)
+				if staging.WaitingFor == "" && gatesEvaluating(evaluation.Status) {
+					staging.WaitingFor = cicd.StagingWaitingForGates
+				}
+			}
+		}
+	}
+
+	if staging.WaitingFor == "" && environment.PreDeployApprovals != nil {
+		for _, a := range *environment.PreDeployApprovals {
+			if a.Status != nil && *a.Status == vstsrelease.ApprovalStatusValues.Pending {
+				staging.WaitingFor = cicd.StagingWaitingForApproval
+				break
+			}
+		}
+	}
+}
+
+// gateEvaluation returns the gate evaluation of a deployment phase, nil if the phase has no gates
+func gateEvaluation(phase string, gates *vstsrelease.ReleaseGates, snapshot *vstsrelease.ReleaseDefinitionGatesStep) *cicd.GateEvaluation {
+	if gates == nil || gates.Id == nil || gates.Status == nil || *gates.Status == vstsrelease.GateStatusValues.None {
+		return nil
+	}
+
+	evaluation := &cicd.GateEvaluation{
+		ID:              *gates.Id,
+		Phase:           phase,
+		Status:          string(*gates.Status),
+		StartedAt:       timeOf(gates.StartedOn),
+		SucceedingSince: timeOf(gates.SucceedingSince),
+	}
+	if gates.IgnoredGates != nil {
+		for _, ig := range *gates.IgnoredGates {
+			if ig.Name != nil {
+				evaluation.IgnoredGates = append(evaluation.IgnoredGates, *ig.Name)
+			}
+		}
+	}
+	if snapshot == nil {
+		return evaluation
+	}
+	if snapshot.Gates != nil {
+		for _, gate := range *snapshot.Gates {
+			if gate.Tasks == nil {
+				continue
+			}
+			for _, task := range *gate.Tasks {
+				if task.Name != nil && (task.Enabled == nil || *task.Enabled) {
+					evaluation.Gates = append(evaluation.Gates, *task.Name)
+				}
+			}
+		}
+	}
+	if snapshot.GatesOptions != nil && snapshot.GatesOptions.Timeout != nil && evaluation.StartedAt != nil {
+		deadline := evaluation.StartedAt.Add(time.Duration(*snapshot.GatesOptions.Timeout) * time.Minute)
+		evaluation.Deadline = &deadline
+	}
+	return evaluation
+}
+
+func gatesEvaluating(status string) bool {
+	return status == string(vstsrelease.GateStatusValues.Pending) || status == string(vstsrelease.GateStatusValues.InProgress)
+}
+
+// resolveInterventions resumes or rejects the pending manual interventions and gate evaluations
+// of staging whose rule is due
+func (c *MonitorClient) resolveInterventions(
+	ctx context.Context,
+	releaseClient releases.ReleaseClient,
+	data *cicd.Data,
+	release *cicd.AKSRelease,
+	staging *cicd.Staging,
+	environment *vstsrelease.ReleaseEnvironment,
+	policy *DeploymentPolicy,
+	now time.Time,
+	logger logrus.FieldLogger,
+) error {
+	for _, record := range staging.Interventions {
+		if record.Status != string(vstsrelease.ManualInterventionStatusValues.Pending) || record.Deadline == nil || now.Before(*record.Deadline) {
+			continue
+		}
+		rule := interventionRule(policy, InterventionKindManual, record.Name)
+		if rule == nil {
+			continue
+		}
+
+		status := vstsrelease.ManualInterventionStatusValues.Approved
+		comment := fmt.Sprintf("resumed by the monitor for %s", data.Date)
+		if rule.Action == InterventionActionReject {
+			status = vstsrelease.ManualInterventionStatusValues.Rejected
+			comment = fmt.Sprintf("rejected by the monitor for %s", data.Date)
+		}
+		updated, err := releaseClient.UpdateManualIntervention(ctx, *release.ReleaseID, record.ID, status, comment)
+		if err != nil {
+			return err
+		}
+		record.Status = string(status)
+		if updated != nil {
+			record.ResolvedBy = identityName(updated.Approver)
+		}
+		record.Comment = comment
+		logger.Infof("manual intervention %q of staging %s is %s", record.Name, staging.Name, status)
+	}
+
+	for _, evaluation := range staging.Gates {
+		if !gatesEvaluating(evaluation.Status) {
+			continue
+		}
+
+		var ignore []string
+		reject := false
+		for _, gate := range evaluation.Gates {
+			rule := interventionRule(policy, InterventionKindGates, gate)
+			if rule == nil || containsFold(evaluation.IgnoredGates, gate) {
+				continue
+			}
+			if deadline := rule.deadline(evaluation.StartedAt); deadline == nil || now.Before(*deadline) {
+				continue
+			}
+			if rule.Action == InterventionActionReject {
+				reject = true
+				break
+			}
+			ignore = append(ignore, gate)
+		}
+
+		if reject && environment.Id != nil {
+			reason := fmt.Sprintf("%s gates of staging %s rejected by the monitor for %s", evaluation.Phase, staging.Name, data.Date)
+			if err := releaseClient.CancelReleaseEnvironment(ctx, *release.ReleaseID, *environment.Id, reason); err != nil {
+				return err
+			}
+			logger.Warnln(reason)
+			return nil
+		}
+		if len(ignore) > 0 {
+			comment := fmt.Sprintf("ignored by the monitor for %s", data.Date)
+			if err := releaseClient.IgnoreGates(ctx, evaluation.ID, ignore, comment); err != nil {
+				return err
+			}
+			evaluation.IgnoredGates = append(evaluation.IgnoredGates, ignore...)
+			logger.Infof("ignored %s gates %v of staging %s", evaluation.Phase, ignore, staging.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+func TestResolveInterventionsRecordsApprover(t *testing.T) {
+	tests := []struct {
+		name       string
+		approver   string
+		action     string
+		wantStatus vstsrelease.ManualInterventionStatus
+	}{
+		{name: "resume", approver: "monitor@contoso.com", action: InterventionActionResume, wantStatus: vstsrelease.ManualInterventionStatusValues.Approved},
+		{name: "reject without approver in the policy", approver: "build-service", action: InterventionActionReject, wantStatus: vstsrelease.ManualInterventionStatusValues.Rejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, releaseClient := newTestClient(t, testConfig())
+			releaseClient.approver = tt.approver
+
+			policy := &DeploymentPolicy{
+				Interventions: []*InterventionRule{{Kind: InterventionKindManual, Action: tt.action}},
+			}
+			now := time.Now().UTC()
+			deadline := now.Add(-time.Minute)
+			record := &cicd.Intervention{
+				ID:       7,
+				Name:     "sign off",
+				Status:   string(vstsrelease.ManualInterventionStatusValues.Pending),
+				Deadline: &deadline,
+			}
+			releaseID := 1000
+			release := &cicd.AKSRelease{DefinitionID: 10, ReleaseID: &releaseID}
+			staging := &cicd.Staging{Name: "canary", Interventions: []*cicd.Intervention{record}}
+			data := &cicd.Data{Date: c.Today()}
+
+			err := c.resolveInterventions(context.Background(), releaseClient, data, release, staging, &vstsrelease.ReleaseEnvironment{}, policy, now, c.logger)
+			if err != nil {
+				t.Fatalf("resolveInterventions() error = %v", err)
+			}
+			if record.Status != string(tt.wantStatus) {
+				t.Errorf("status = %s, want %s", record.Status, tt.wantStatus)
+			}
+			if record.ResolvedBy != tt.approver {
+				t.Errorf("resolved by %q, want %q", record.ResolvedBy, tt.approver)
+			}
+		})
+	}
+}
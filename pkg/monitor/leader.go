@@ -0,0 +1,245 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/storageaccountv2"
+)
+
+const (
+	defaultLeaseBlob            = "monitor-leader"
+	defaultLeaseDurationSeconds = 60
+	defaultRenewIntervalSeconds = 20
+	defaultRetryIntervalSeconds = 15
+	minLeaseDurationSeconds     = 15
+	maxLeaseDurationSeconds     = 60
+	leaseReleaseTimeout         = 10 * time.Second
+)
+
+// ErrLeaderActive is returned by a single cycle while another replica holds the leader lease
+var ErrLeaderActive = errors.New("another replica holds the leader lease")
+
+// errLeaseLost is returned by the writes skipped once the leader lease is lost
+var errLeaseLost = errors.New("leader lease was lost")
+
+// leader isn't labeled with the lease identity, which changes on every restart, replicas are told
+// apart by the labels of their scrape target
+var leader = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "monitor_leader",
+	Help: "Whether this replica holds the leader lease (1) or is a follower (0).",
+})
+
+// LeaderElectionConfig lets several replicas run side by side, only the replica holding the lease
+// of a blob in the storage account reconciles, the others only serve the status endpoints
+type LeaderElectionConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// LeaseBlob is the name of the blob whose lease elects the leader
+	LeaseBlob string `json:"lease_blob,omitempty"`
+
+	// LeaseDurationSeconds is the duration of the lease, between 15 and 60 seconds
+	LeaseDurationSeconds int `json:"lease_duration_seconds,omitempty"`
+
+	// RenewIntervalSeconds is how often the leader renews the lease
+	RenewIntervalSeconds int `json:"renew_interval_seconds,omitempty"`
+
+	// RetryIntervalSeconds is how often followers try to acquire the lease
+	RetryIntervalSeconds int `json:"retry_interval_seconds,omitempty"`
+}
+
+// leaderElectionConfig returns the leader election config with defaults applied, nil if disabled
+func (c *Config) leaderElectionConfig() (*LeaderElectionConfig, error) {
+	if c.LeaderElection == nil || !c.LeaderElection.Enabled {
+		return nil, nil
+	}
+
+	config := *c.LeaderElection
+	if config.LeaseBlob == "" {
+		config.LeaseBlob = defaultLeaseBlob
+	}
+	if config.LeaseDurationSeconds == 0 {
+		config.LeaseDurationSeconds = defaultLeaseDurationSeconds
+	}
+	if config.RenewIntervalSeconds <= 0 {
+		config.RenewIntervalSeconds = defaultRenewIntervalSeconds
+	}
+	if config.RetryIntervalSeconds <= 0 {
+		config.RetryIntervalSeconds = defaultRetryIntervalSeconds
+	}
+
+	if config.LeaseDurationSeconds < minLeaseDurationSeconds || config.LeaseDurationSeconds > maxLeaseDurationSeconds {
+		return nil, fmt.Errorf("lease duration must be between %d and %d seconds", minLeaseDurationSeconds, maxLeaseDurationSeconds)
+	}
+	if config.RenewIntervalSeconds >= config.LeaseDurationSeconds {
+		return nil, fmt.Errorf("renew interval must be shorter than the lease duration")
+	}
+	return &config, nil
+}
+
+// leaderElector elects the leader among the replicas with the lease of a blob
+type leaderElector struct {
+	blobClient storageaccountv2.BlobClient
+	config     LeaderElectionConfig
+	identity   string
+
+	mu      sync.RWMutex
+	leading bool
+
+	logger logrus.FieldLogger
+}
+
+func buildLeaderElector(blobClient storageaccountv2.BlobClient, config LeaderElectionConfig, rootLogger logrus.FieldLogger) *leaderElector {
+	identity := uuid.New().String()
+	leader.Set(0)
+	return &leaderElector{
+		blobClient: blobClient,
+		config:     config,
+		identity:   identity,
+		logger: rootLogger.WithFields(logrus.Fields{
+			"source":   "leader election",
+			"identity": identity,
+		}),
+	}
+}
+
+// isLeader checks whether this replica holds the lease
+func (e *leaderElector) isLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leading
+}
+
+func (e *leaderElector) setLeader(leading bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leading = leading
+	if leading {
+		leader.Set(1)
+	} else {
+		leader.Set(0)
+	}
+}
+
+// acquire blocks until the lease is acquired, an error is returned only if ctx is canceled
+func (e *leaderElector) acquire(ctx context.Context) error {
+	for {
+		err := e.tryAcquire(ctx)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, ErrLeaderActive) {
+			e.logger.WithError(err).Warn("failed to acquire the leader lease")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(e.config.RetryIntervalSeconds) * time.Second):
+		}
+	}
+}
+
+// tryAcquire makes a single attempt to acquire the lease, ErrLeaderActive is returned if another
+// replica holds it
+func (e *leaderElector) tryAcquire(ctx context.Context) error {
+	duration := time.Duration(e.config.LeaseDurationSeconds) * time.Second
+	err := e.blobClient.AcquireLease(ctx, e.config.LeaseBlob, e.identity, duration)
+	if errors.Is(err, storageaccountv2.ErrLeaseAlreadyPresent) {
+		return ErrLeaderActive
+	}
+	if err != nil {
+		return err
+	}
+	e.logger.Infoln("acquired the leader lease")
+	e.setLeader(true)
+	return nil
+}
+
+type leaseLostKey struct{}
+
+// leaseLost returns a channel closed once the leader lease held by hold for ctx is lost, nil if ctx
+// doesn't come from hold
+func leaseLost(ctx context.Context) <-chan struct{} {
+	lost, _ := ctx.Value(leaseLostKey{}).(chan struct{})
+	return lost
+}
+
+// isLeaseLost checks whether the leader lease held for ctx was lost
+func isLeaseLost(ctx context.Context) bool {
+	select {
+	case <-leaseLost(ctx):
+		return true
+	default:
+		return false
+	}
+}
+
+// hold renews the lease until ctx is canceled or the lease is lost. The returned context is canceled
+// once the lease is lost, release stops renewing and hands the lease over to the other replicas.
+func (e *leaderElector) hold(ctx context.Context) (context.Context, func()) {
+	lost := make(chan struct{})
+	leaderCtx, cancel := context.WithCancel(context.WithValue(ctx, leaseLostKey{}, lost))
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		duration := time.Duration(e.config.LeaseDurationSeconds) * time.Second
+		interval := time.Duration(e.config.RenewIntervalSeconds) * time.Second
+		renewedAt := time.Now()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-leaderCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := e.blobClient.RenewLease(leaderCtx, e.config.LeaseBlob, e.identity)
+			if err == nil {
+				renewedAt = time.Now()
+				continue
+			}
+			if leaderCtx.Err() != nil {
+				return
+			}
+
+			// give up once the lease would expire before the next attempt
+			if time.Since(renewedAt)+interval >= duration {
+				e.logger.WithError(err).Error("lost the leader lease")
+				e.setLeader(false)
+				close(lost)
+				cancel()
+				return
+			}
+			e.logger.WithError(err).Warn("failed to renew the leader lease")
+		}
+	}()
+
+	release := func() {
+		cancel()
+		<-done
+		if !e.isLeader() {
+			return
+		}
+
+		e.setLeader(false)
+		releaseCtx, cancel := context.WithTimeout(context.Background(), leaseReleaseTimeout)
+		defer cancel()
+		if err := e.blobClient.ReleaseLease(releaseCtx, e.config.LeaseBlob, e.identity); err != nil {
+			e.logger.WithError(err).Error("failed to release the leader lease")
+			return
+		}
+		e.logger.Infoln("released the leader lease")
+	}
+	return leaderCtx, release
+}
@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+var (
+	dataStateGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "monitor_data_state",
+		Help: "Current state of the CI/CD process of the day, 1 for the current state.",
+	}, []string{"flow", "date", "state"})
+	dataStateDuration = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "monitor_data_state_duration_seconds_total",
+		Help: "Time the CI/CD process spent in each state.",
+	}, []string{"flow", "state"})
+	aksBuildAttempts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "monitor_aks_build_attempts",
+		Help: "Number of [EV2] AKS Build queued for the day.",
+	}, []string{"flow", "date"})
+	stagingStatusGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "monitor_release_staging_status",
+		Help: "Status of each release staging, 1 for the current status.",
+	}, []string{"flow", "definition_id", "staging", "status"})
+	stateStoreFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "monitor_state_store_failures_total",
+		Help: "Number of failed reads and writes of the state store.",
+	}, []string{"flow", "operation"})
+	stateStoreConflicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "monitor_state_store_conflicts_total",
+		Help: "Number of concurrent modifications of the data found when persisting it, by whether they were merged or the cycle aborted.",
+	}, []string{"flow", "result"})
+	cycles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "monitor_cycles_total",
+		Help: "Number of monitor cycles by result.",
+	}, []string{"flow", "result"})
+	lastCycleTimestamp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "monitor_last_cycle_timestamp_seconds",
+		Help: "Unix time the latest monitor cycle finished.",
+	}, []string{"flow"})
+)
+
+// gaugeSeries remembers the label values of the series a flow set on gauges, so that the series
+// of a previous day, state or staging are removed instead of being exported forever
+type gaugeSeries map[*prometheus.GaugeVec][][]string
+
+// set sets the series of labelValues of gauge to value and remembers it
+func (s gaugeSeries) set(gauge *prometheus.GaugeVec, value float64, labelValues ...string) {
+	gauge.WithLabelValues(labelValues...).Set(value)
+	s[gauge] = append(s[gauge], labelValues)
+}
+
+// reset removes all series of gauge set since the previous reset
+func (s gaugeSeries) reset(gauge *prometheus.GaugeVec) {
+	for _, labelValues := range s[gauge] {
+		gauge.DeleteLabelValues(labelValues...)
+	}
+	delete(s, gauge)
+}
+
+// flowName identifies the monitored flow in metrics
+func (c *MonitorClient) flowName() string {
+	return c.config.name()
+}
+
+// recordCycleMetrics updates the metrics derived from data at the end of a cycle
+func (c *MonitorClient) recordCycleMetrics(data *cicd.Data, err error) {
+	flow := c.flowName()
+	now := time.Now()
+
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	cycles.WithLabelValues(flow, result).Inc()
+	lastCycleTimestamp.WithLabelValues(flow).Set(float64(now.Unix()))
+
+	if data == nil {
+		return
+	}
+
+	// the time since the previous cycle is accounted to the state observed by it
+	if !c.stateObservedAt.IsZero() {
+		dataStateDuration.WithLabelValues(flow, string(c.stateObserved)).Add(now.Sub(c.stateObservedAt).Seconds())
+	}
+	c.stateObservedAt = now
+	c.stateObserved = data.State
+
+	c.series.reset(dataStateGauge)
+	c.series.set(dataStateGauge, 1, flow, data.Date, string(data.State))
+
+	c.series.reset(aksBuildAttempts)
+	if data.AKSBuild != nil {
+		c.series.set(aksBuildAttempts, float64(data.AKSBuild.Count), flow, data.Date)
+	}
+
+	c.series.reset(stagingStatusGauge)
+	for _, r := range data.AKSRelease {
+		for _, s := range r.Staging {
+			status := "unknown"
+			if s.Status != nil {
+				status = *s.Status
+			}
+			c.series.set(stagingStatusGauge, 1, flow, strconv.Itoa(r.DefinitionID), s.Name, status)
+		}
+	}
+}
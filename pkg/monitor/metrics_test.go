@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+// exportedSeries returns the label values of the series of the metric family name exported for flow
+func exportedSeries(t *testing.T, name string, flow string) []map[string]string {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result []map[string]string
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["flow"] == flow {
+				result = append(result, labels)
+			}
+		}
+	}
+	return result
+}
+
+func TestRecordCycleMetricsRemovesStaleSeries(t *testing.T) {
+	config := testConfig()
+	config.Name = "metrics"
+	c, _, _ := newTestClient(t, config)
+
+	status := "inProgress"
+	c.recordCycleMetrics(&cicd.Data{
+		Date:     "2021-03-01",
+		State:    cicd.DataStateValues.ReleaseInProgress,
+		AKSBuild: &cicd.AKSBuild{Count: 1},
+		AKSRelease: []*cicd.AKSRelease{
+			{DefinitionID: 10, Staging: []*cicd.Staging{{Name: "canary", Status: &status}}},
+		},
+	}, nil)
+	c.recordCycleMetrics(&cicd.Data{
+		Date:  "2021-03-02",
+		State: cicd.DataStateValues.NotStart,
+	}, nil)
+
+	states := exportedSeries(t, "monitor_data_state", config.Name)
+	if len(states) != 1 || states[0]["date"] != "2021-03-02" || states[0]["state"] != string(cicd.DataStateValues.NotStart) {
+		t.Errorf("monitor_data_state series = %v, want only the state of 2021-03-02", states)
+	}
+	if attempts := exportedSeries(t, "monitor_aks_build_attempts", config.Name); len(attempts) != 0 {
+		t.Errorf("monitor_aks_build_attempts series = %v, want none", attempts)
+	}
+	if stagings := exportedSeries(t, "monitor_release_staging_status", config.Name); len(stagings) != 0 {
+		t.Errorf("monitor_release_staging_status series = %v, want none", stagings)
+	}
+}
+
+// TestLeaderMetricSeries checks restarts of the elector, each with a new lease identity, keep a single series
+func TestLeaderMetricSeries(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		buildLeaderElector(nil, LeaderElectionConfig{}, logrus.New()).setLeader(i == 1)
+	}
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != "monitor_leader" {
+			continue
+		}
+		if metrics := family.GetMetric(); len(metrics) != 1 || len(metrics[0].GetLabel()) != 0 || metrics[0].GetGauge().GetValue() != 1 {
+			t.Errorf("monitor_leader series = %v, want a single unlabeled series", metrics)
+		}
+		return
+	}
+	t.Error("monitor_leader isn't exported")
+}
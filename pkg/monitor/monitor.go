@@ -0,0 +1,198 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/storageaccountv2"
+)
+
+// Monitor runs a MonitorClient for every flow of the config
+type Monitor struct {
+	clients []*MonitorClient
+
+	// elector is nil if leader election is disabled, the replica then always leads
+	elector *leaderElector
+
+	// dryRun is set once EnableDryRun was called, nothing is written
+	dryRun bool
+
+	logger logrus.FieldLogger
+}
+
+// BuildMonitor creates an instance of Monitor, all flows share the state store
+func BuildMonitor(
+	storageAccessKey string,
+	personalAccessToken string,
+	config *Config,
+	rootLogger logrus.FieldLogger,
+) (*Monitor, error) {
+	flows, err := config.flows()
+	if err != nil {
+		return nil, fmt.Errorf("invalid flows: %w", err)
+	}
+
+	store, err := buildStateStore(storageAccessKey, config, rootLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Monitor{
+		logger: rootLogger,
+	}
+
+	election, err := config.leaderElectionConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid leader election: %w", err)
+	}
+	if election != nil {
+		if storageAccessKey == "" {
+			return nil, fmt.Errorf("storage access key is required by leader election")
+		}
+		blobClient := storageaccountv2.BuildBlobClient(config.AzureStorageAccount, config.AzureStorageContainer, storageAccessKey, rootLogger)
+		m.elector = buildLeaderElector(blobClient, *election, rootLogger)
+	}
+	for _, f := range flows {
+		client, err := BuildClient(personalAccessToken, f, config.supervisorConfig(), store, rootLogger)
+		if err != nil {
+			return nil, fmt.Errorf("flow %s: %w", f.name(), err)
+		}
+		m.clients = append(m.clients, client)
+	}
+	return m, nil
+}
+
+// Run runs the monitor routine of every flow until ctx is canceled. With leader election the
+// routines only run while this replica holds the lease, followers wait for the lease to be free.
+func (m *Monitor) Run(ctx context.Context) error {
+	if m.elector == nil {
+		return m.runFlows(ctx)
+	}
+
+	for {
+		m.logger.Infoln("waiting for the leader lease")
+		if err := m.elector.acquire(ctx); err != nil {
+			return nil
+		}
+
+		leaderCtx, release := m.elector.hold(ctx)
+		err := m.runFlows(leaderCtx)
+		release()
+		if err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		m.logger.Warnln("lost the leader lease, monitor is stopped until it is acquired again")
+	}
+}
+
+// isLeader checks whether this replica reconciles the flows
+func (m *Monitor) isLeader() bool {
+	return m.elector == nil || m.elector.isLeader()
+}
+
+// runFlows runs the monitor routine of every flow concurrently until ctx is canceled, if the routine
+// of any flow gives up, the others are stopped and its error is returned
+func (m *Monitor) runFlows(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(m.clients))
+	for _, c := range m.clients {
+		go func(c *MonitorClient) {
+			err := c.MonitorRoutine(ctx)
+			if err != nil {
+				err = fmt.Errorf("flow %s: %w", c.config.name(), err)
+				cancel()
+			}
+			errs <- err
+		}(c)
+	}
+
+	var result error
+	for range m.clients {
+		if err := <-errs; err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// CycleResult is the outcome of a single cycle of a flow
+type CycleResult struct {
+	Flow string
+	Data *cicd.Data
+	Err  error
+
+	// Plan lists the actions a dry run would have taken
+	Plan []string
+}
+
+// ReconcileOnce runs a single cycle of every flow concurrently. With leader election the cycles
+// hold the leader lease, ErrLeaderActive is returned without running any cycle if another replica
+// leads. A dry run writes nothing and runs without the lease.
+func (m *Monitor) ReconcileOnce(ctx context.Context) ([]*CycleResult, error) {
+	if m.elector != nil && !m.dryRun {
+		if err := m.elector.tryAcquire(ctx); err != nil {
+			return nil, err
+		}
+		leaderCtx, release := m.elector.hold(ctx)
+		defer release()
+		ctx = leaderCtx
+	}
+
+	results := make([]*CycleResult, len(m.clients))
+	var wg sync.WaitGroup
+	for i, c := range m.clients {
+		wg.Add(1)
+		go func(i int, c *MonitorClient) {
+			defer wg.Done()
+			cycleCtx, cancel := cycleContext(ctx, c.supervisor)
+			defer cancel()
+			data, err := c.reconcile(cycleCtx)
+			results[i] = &CycleResult{
+				Flow: c.config.name(),
+				Data: data,
+				Err:  err,
+				Plan: c.plan.list(),
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// Select returns a monitor of the flow named name only
+func (m *Monitor) Select(name string) (*Monitor, error) {
+	c, err := m.Client(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Monitor{
+		clients: []*MonitorClient{c},
+		elector: m.elector,
+		dryRun:  m.dryRun,
+		logger:  m.logger,
+	}, nil
+}
+
+// Client returns the MonitorClient of the flow named name, name may be empty if there is one flow
+func (m *Monitor) Client(name string) (*MonitorClient, error) {
+	if name == "" && len(m.clients) == 1 {
+		return m.clients[0], nil
+	}
+	for _, c := range m.clients {
+		if c.config.name() == name {
+			return c, nil
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("flow must be selected among %d flows", len(m.clients))
+	}
+	return nil, fmt.Errorf("unknown flow %q", name)
+}
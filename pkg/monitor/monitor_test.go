@@ -0,0 +1,127 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/storageaccountv2"
+)
+
+// fakeLeaseClient keeps the lease of a blob in memory. The methods the elector isn't expected to
+// call panic through the embedded nil interface.
+type fakeLeaseClient struct {
+	storageaccountv2.BlobClient
+
+	mu     sync.Mutex
+	holder string
+
+	released bool
+}
+
+func (c *fakeLeaseClient) AcquireLease(ctx context.Context, blobName string, leaseID string, duration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.holder != "" && c.holder != leaseID {
+		return storageaccountv2.ErrLeaseAlreadyPresent
+	}
+	c.holder = leaseID
+	return nil
+}
+
+func (c *fakeLeaseClient) RenewLease(ctx context.Context, blobName string, leaseID string) error {
+	return nil
+}
+
+func (c *fakeLeaseClient) ReleaseLease(ctx context.Context, blobName string, leaseID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.holder == leaseID {
+		c.holder = ""
+		c.released = true
+	}
+	return nil
+}
+
+func TestReconcileOnce(t *testing.T) {
+	tests := []struct {
+		name       string
+		held       bool
+		dryRun     bool
+		wantErr    error
+		wantQueued int
+		wantPlan   string
+		wantStored bool
+	}{
+		{
+			name:       "lease is free",
+			wantQueued: 1,
+			wantStored: true,
+		},
+		{
+			name:    "another replica leads",
+			held:    true,
+			wantErr: ErrLeaderActive,
+		},
+		{
+			name:     "dry run while another replica leads",
+			held:     true,
+			dryRun:   true,
+			wantPlan: "queue build of pipeline 2 for commit abc123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, pipelineClient, _ := newTestClient(t, testConfig())
+			pipelineClient.validate(1, "abc123")
+			store := c.store
+
+			leaseClient := &fakeLeaseClient{}
+			if tt.held {
+				leaseClient.holder = "leader"
+			}
+			config := LeaderElectionConfig{LeaseDurationSeconds: 60, RenewIntervalSeconds: 20}
+			m := &Monitor{
+				clients: []*MonitorClient{c},
+				elector: buildLeaderElector(leaseClient, config, logrus.New()),
+				logger:  c.logger,
+			}
+			if tt.dryRun {
+				m.EnableDryRun()
+			}
+
+			results, err := m.ReconcileOnce(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReconcileOnce() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(pipelineClient.queued) != 0 {
+					t.Errorf("queued %v while another replica leads", pipelineClient.queued)
+				}
+				return
+			}
+
+			if len(results) != 1 || results[0].Err != nil {
+				t.Fatalf("results = %+v, want a succeeded cycle", results)
+			}
+			if len(pipelineClient.queued) != tt.wantQueued {
+				t.Errorf("queued %d builds, want %d", len(pipelineClient.queued), tt.wantQueued)
+			}
+			if planned := strings.Join(results[0].Plan, "\n"); !strings.Contains(planned, tt.wantPlan) || (tt.wantPlan == "" && planned != "") {
+				t.Errorf("plan = %v, want %q", results[0].Plan, tt.wantPlan)
+			}
+			_, _, err = store.GetData(context.Background(), c.blobName(c.Today()))
+			if stored := err == nil; stored != tt.wantStored {
+				t.Errorf("data of the day stored = %v, want %v", stored, tt.wantStored)
+			}
+			if !tt.held && (!leaseClient.released || m.elector.isLeader()) {
+				t.Error("the lease wasn't released once the cycle finished")
+			}
+		})
+	}
+}
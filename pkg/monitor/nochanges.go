@@ -0,0 +1,54 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+const defaultReleaseLookbackDays = 7
+
+// releasedStates are the outcomes of the days whose commit is considered released
+var releasedStates = map[cicd.DataState]bool{
+	cicd.DataStateValues.ReleaseSucceeded:          true,
+	cicd.DataStateValues.ReleasePartiallySucceeded: true,
+	cicd.DataStateValues.NoChanges:                 true,
+}
+
+// releaseLookbackDays returns the number of earlier days searched for the released commit
+func (c *FlowConfig) releaseLookbackDays() int {
+	if c.ReleaseLookbackDays > 0 {
+		return c.ReleaseLookbackDays
+	}
+	return defaultReleaseLookbackDays
+}
+
+// releasedCommit returns the commit released by the latest of the earlier days of date and that
+// day, an empty commit is returned if none of the days of the lookback released a commit
+func (c *MonitorClient) releasedCommit(ctx context.Context, date string) (string, string, error) {
+	day, err := c.schedule.startOfDay(date)
+	if err != nil {
+		return "", "", err
+	}
+
+	for i := 1; i <= c.config.releaseLookbackDays(); i++ {
+		previous := day.AddDate(0, 0, -i).Format(dateFormat)
+		data, _, err := c.store.GetData(ctx, c.blobName(previous))
+		if errors.Is(err, statestore.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			stateStoreFailures.WithLabelValues(c.flowName(), "read").Inc()
+			return "", "", fmt.Errorf("get data of %s: %w", previous, err)
+		}
+
+		if !releasedStates[data.State] || data.MasterValidation == nil || data.MasterValidation.CommitID == nil {
+			continue
+		}
+		return *data.MasterValidation.CommitID, previous, nil
+	}
+	return "", "", nil
+}
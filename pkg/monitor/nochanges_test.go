@@ -0,0 +1,115 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+// earlierDay is a day before today which ended in state with commit
+type earlierDay struct {
+	days   int
+	state  cicd.DataState
+	commit string
+}
+
+func TestReleasedCommit(t *testing.T) {
+	tests := []struct {
+		name       string
+		lookback   int
+		days       []earlierDay
+		wantCommit string
+		wantDays   int
+	}{
+		{
+			name: "no earlier day",
+		},
+		{
+			name:       "released yesterday",
+			days:       []earlierDay{{1, cicd.DataStateValues.ReleaseSucceeded, "abc123"}},
+			wantCommit: "abc123",
+			wantDays:   1,
+		},
+		{
+			name: "failed release isn't released",
+			days: []earlierDay{
+				{1, cicd.DataStateValues.ReleaseFailed, "def456"},
+				{2, cicd.DataStateValues.ReleasePartiallySucceeded, "abc123"},
+			},
+			wantCommit: "abc123",
+			wantDays:   2,
+		},
+		{
+			name:       "day without changes keeps the released commit",
+			days:       []earlierDay{{1, cicd.DataStateValues.NoChanges, "abc123"}},
+			wantCommit: "abc123",
+			wantDays:   1,
+		},
+		{
+			name:     "release older than the lookback",
+			lookback: 2,
+			days:     []earlierDay{{3, cicd.DataStateValues.ReleaseSucceeded, "abc123"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.ReleaseLookbackDays = tt.lookback
+			c, _, _ := newTestClient(t, config)
+			date := c.Today()
+			for _, d := range tt.days {
+				storeEarlierDay(t, c, date, d.days, d.state, d.commit)
+			}
+
+			commit, releasedOn, err := c.releasedCommit(context.Background(), date)
+			if err != nil {
+				t.Fatalf("releasedCommit() error = %v", err)
+			}
+			if commit != tt.wantCommit {
+				t.Errorf("releasedCommit() commit = %q, want %q", commit, tt.wantCommit)
+			}
+			if tt.wantDays > 0 {
+				day, _ := c.schedule.startOfDay(date)
+				if want := day.AddDate(0, 0, -tt.wantDays).Format(dateFormat); releasedOn != want {
+					t.Errorf("releasedCommit() day = %s, want %s", releasedOn, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTriggerAKSBuildNoChanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		validated  string
+		wantState  cicd.DataState
+		wantQueued int
+	}{
+		{name: "commit already released", validated: "abc123", wantState: cicd.DataStateValues.NoChanges},
+		{name: "new commit", validated: "def456", wantState: cicd.DataStateValues.NotStart, wantQueued: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, pipelineClient, _ := newTestClient(t, testConfig())
+			storeEarlierDay(t, c, c.Today(), 1, cicd.DataStateValues.ReleaseSucceeded, "abc123")
+			pipelineClient.validate(1, tt.validated)
+
+			data, err := c.reconcile(context.Background())
+			if err != nil {
+				t.Fatalf("reconcile() error = %v", err)
+			}
+			if data.State != tt.wantState {
+				t.Errorf("state = %s, want %s", data.State, tt.wantState)
+			}
+			if len(pipelineClient.queued) != tt.wantQueued {
+				t.Errorf("queued %d builds, want %d", len(pipelineClient.queued), tt.wantQueued)
+			}
+			if got := *data.MasterValidation.CommitID; got != tt.validated {
+				t.Errorf("picked commit = %s, want %s", got, tt.validated)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+// GetDay returns the data of date, a fresh record is returned if the day has no data yet
+func (c *MonitorClient) GetDay(ctx context.Context, date string) (*cicd.Data, error) {
+	data, _, err := c.GetDataFromBlob(ctx, date)
+	return data, err
+}
+
+// SetState moves the day of date to state. The states the monitor drives a day from can be forced
+// to repair a day, what the stages after state recorded is cleared and the day starts over in a new
+// generation, so that the monitor runs them again instead of adopting what it queued before, e.g.
+// the releases are created again once back to BuildSucceeded. An error is returned if the day lacks
+// what state needs. The other states end the day, they must be allowed by the transition table.
+func (c *MonitorClient) SetState(ctx context.Context, date string, state cicd.DataState, reason string) (*cicd.Data, error) {
+	return c.updateDay(ctx, date, func(data *cicd.Data) error {
+		fresh := c.flow.newData(date)
+		startOver := true
+		switch state {
+		case cicd.DataStateValues.None:
+			data.MasterValidation = fresh.MasterValidation
+			data.AKSBuild = nil
+			data.AKSRelease = fresh.AKSRelease
+			data.Failure = nil
+			data.Freeze = nil
+		case cicd.DataStateValues.NotStart, cicd.DataStateValues.BuildInProgress, cicd.DataStateValues.BuildFailed:
+			if data.AKSBuild == nil || data.AKSBuild.ID == 0 {
+				return fmt.Errorf("no build of %s to move to %s", date, state)
+			}
+			data.AKSRelease = fresh.AKSRelease
+			data.Failure = nil
+		case cicd.DataStateValues.BuildSucceeded:
+			if _, number := c.artifactOf(data, c.flow.buildStage().Name); number == "" {
+				return fmt.Errorf("no build of %s to release", date)
+			}
+			data.AKSRelease = fresh.AKSRelease
+			data.Failure = nil
+			data.Freeze = nil
+		case cicd.DataStateValues.ReleaseInProgress:
+			if _, number := c.artifactOf(data, c.flow.buildStage().Name); number == "" {
+				return fmt.Errorf("no build of %s to release", date)
+			}
+			data.Failure = nil
+			startOver = false
+		default:
+			return data.TransitionTo(state, operatorReason(reason))
+		}
+
+		if startOver {
+			data.Generation++
+		}
+		data.ForceTo(state, operatorReason(reason))
+		return nil
+	})
+}
+
+// ResetDay replaces the data of date with a fresh record, so that the monitor starts the day over
+// in a new generation. The events are kept as the history of the day.
+func (c *MonitorClient) ResetDay(ctx context.Context, date string, reason string) (*cicd.Data, error) {
+	return c.updateDay(ctx, date, func(data *cicd.Data) error {
+		fresh := c.flow.newData(date)
+		fresh.State = data.State
+		fresh.Events = data.Events
+		fresh.Paused = data.Paused
+		fresh.FreezeOverride = data.FreezeOverride
+		fresh.Generation = data.Generation + 1
+		*data = *fresh
+		data.ForceTo(cicd.DataStateValues.None, operatorReason(reason))
+		return nil
+	})
+}
+
+// SetPaused pauses or resumes the monitor for date
+func (c *MonitorClient) SetPaused(ctx context.Context, date string, paused bool) (*cicd.Data, error) {
+	return c.updateDay(ctx, date, func(data *cicd.Data) error {
+		data.Paused = paused
+		return nil
+	})
+}
+
+// SetFreezeOverride lets date start builds and releases during a freeze, or respects the freeze
+// again. A day skipped for a freeze goes back to the state it was skipped from.
+func (c *MonitorClient) SetFreezeOverride(ctx context.Context, date string, override bool, reason string) (*cicd.Data, error) {
+	return c.updateDay(ctx, date, func(data *cicd.Data) error {
+		data.FreezeOverride = override
+		if !override || data.State != cicd.DataStateValues.SkippedFreeze {
+			return nil
+		}
+
+		previous := cicd.DataStateValues.None
+		if n := len(data.Events); n > 0 && data.Events[n-1].To == data.State {
+			previous = data.Events[n-1].From
+		}
+		data.Freeze = nil
+		data.ForceTo(previous, operatorReason(reason))
+		return nil
+	})
+}
+
+// updateDay applies update to the data of date and persists it. The data is read again and update
+// applied again if the monitor modified the data concurrently.
+func (c *MonitorClient) updateDay(ctx context.Context, date string, update func(data *cicd.Data) error) (*cicd.Data, error) {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action": "updateDay",
+		"date":   date,
+	})
+
+	for attempt := 1; ; attempt++ {
+		data, version, err := c.GetDataFromBlob(ctx, date)
+		if err != nil {
+			return nil, err
+		}
+		if err := update(data); err != nil {
+			return nil, err
+		}
+
+		_, err = c.UploadDataToBlob(ctx, date, data, version)
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, statestore.ErrConflict) || attempt >= maxMergeAttempts {
+			return nil, err
+		}
+		logger.Infoln("data was modified concurrently, updating it again")
+	}
+}
+
+func operatorReason(reason string) string {
+	if reason == "" {
+		return "set by operator"
+	}
+	return "set by operator: " + reason
+}
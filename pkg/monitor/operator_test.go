@@ -0,0 +1,146 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+// TestResetDayQueuesNewBuild checks the build of the day before a reset isn't adopted again
+func TestResetDayQueuesNewBuild(t *testing.T) {
+	c, pipelineClient, _ := newTestClient(t, testConfig())
+	ctx := context.Background()
+	pipelineClient.validate(1, "abc123")
+
+	data, err := c.reconcile(ctx)
+	if err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	failed := data.AKSBuild.ID
+	pipelineClient.complete(failed, vstsbuild.BuildResultValues.Failed)
+
+	if _, err := c.ResetDay(ctx, data.Date, "start over"); err != nil {
+		t.Fatalf("ResetDay() error = %v", err)
+	}
+	data, err = c.reconcile(ctx)
+	if err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+
+	if data.Generation != 1 {
+		t.Errorf("generation = %d, want 1", data.Generation)
+	}
+	if len(pipelineClient.queued) != 2 || data.AKSBuild.ID == failed {
+		t.Errorf("build %d adopted after the reset, queued %d builds", data.AKSBuild.ID, len(pipelineClient.queued))
+	}
+}
+
+// TestSetStateCreatesNewReleases checks moving a failed release back to BuildSucceeded creates the
+// releases again instead of adopting the failed ones
+func TestSetStateCreatesNewReleases(t *testing.T) {
+	c, pipelineClient, releaseClient := newTestClient(t, testConfig())
+	ctx := context.Background()
+	pipelineClient.validate(1, "abc123")
+
+	var data *cicd.Data
+	reconcile := func() {
+		t.Helper()
+		var err error
+		if data, err = c.reconcile(ctx); err != nil {
+			t.Fatalf("reconcile() error = %v", err)
+		}
+	}
+	reconcile()
+	reconcile()
+	pipelineClient.complete(data.AKSBuild.ID, vstsbuild.BuildResultValues.Succeeded)
+	reconcile()
+	reconcile()
+	failed := *data.AKSRelease[0].ReleaseID
+	releaseClient.setStaging(failed, "canary", vstsrelease.EnvironmentStatusValues.Rejected)
+	reconcile()
+	if data.State != cicd.DataStateValues.ReleaseRejected {
+		t.Fatalf("state = %s, want %s", data.State, cicd.DataStateValues.ReleaseRejected)
+	}
+
+	if _, err := c.SetState(ctx, data.Date, cicd.DataStateValues.BuildSucceeded, "release again"); err != nil {
+		t.Fatalf("SetState() error = %v", err)
+	}
+	reconcile()
+
+	if len(releaseClient.created) != 2 || *data.AKSRelease[0].ReleaseID == failed {
+		t.Errorf("release %d adopted after the state was set, created %d releases", *data.AKSRelease[0].ReleaseID, len(releaseClient.created))
+	}
+}
+
+func TestSetStatePreconditions(t *testing.T) {
+	buildNumber := "20210301.1"
+	tests := []struct {
+		name    string
+		data    *cicd.Data
+		state   cicd.DataState
+		wantErr bool
+	}{
+		{
+			name:  "start the day over",
+			data:  &cicd.Data{State: cicd.DataStateValues.ReleaseFailed},
+			state: cicd.DataStateValues.None,
+		},
+		{
+			name:    "build state without build",
+			data:    &cicd.Data{State: cicd.DataStateValues.None},
+			state:   cicd.DataStateValues.BuildFailed,
+			wantErr: true,
+		},
+		{
+			name:  "build state with build",
+			data:  &cicd.Data{State: cicd.DataStateValues.BuildAbandoned, AKSBuild: &cicd.AKSBuild{ID: 5, Count: 3}},
+			state: cicd.DataStateValues.BuildFailed,
+		},
+		{
+			name:    "release without build",
+			data:    &cicd.Data{State: cicd.DataStateValues.BuildFailed, AKSBuild: &cicd.AKSBuild{ID: 5}},
+			state:   cicd.DataStateValues.BuildSucceeded,
+			wantErr: true,
+		},
+		{
+			name:  "release with build",
+			data:  &cicd.Data{State: cicd.DataStateValues.ReleaseFailed, AKSBuild: &cicd.AKSBuild{ID: 5, BuildNumber: &buildNumber}},
+			state: cicd.DataStateValues.ReleaseInProgress,
+		},
+		{
+			name:  "allowed outcome",
+			data:  &cicd.Data{State: cicd.DataStateValues.BuildFailed, AKSBuild: &cicd.AKSBuild{ID: 5}},
+			state: cicd.DataStateValues.BuildAbandoned,
+		},
+		{
+			name:    "outcome the transition table forbids",
+			data:    &cicd.Data{State: cicd.DataStateValues.BuildInProgress, AKSBuild: &cicd.AKSBuild{ID: 5}},
+			state:   cicd.DataStateValues.ReleaseSucceeded,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, _ := newTestClient(t, testConfig())
+			ctx := context.Background()
+			date := c.Today()
+			tt.data.Date = date
+			if _, err := c.UploadDataToBlob(ctx, date, tt.data, statestore.VersionAny); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := c.SetState(ctx, date, tt.state, "test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && data.State != tt.state {
+				t.Errorf("state = %s, want %s", data.State, tt.state)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+// succeededBuildDay returns the data of today whose build 5 succeeded
+func succeededBuildDay(c *MonitorClient) *cicd.Data {
+	buildNumber, result := "20210301.1", string(vstsbuild.BuildResultValues.Succeeded)
+	data := c.flow.newData(c.Today())
+	data.State = cicd.DataStateValues.BuildSucceeded
+	data.AKSBuild = &cicd.AKSBuild{ID: 5, Count: 1, BuildNumber: &buildNumber, BuildResult: &result}
+	return data
+}
+
+// passBackoff lets the failed creations of data be retried on the next cycle
+func passBackoff(data *cicd.Data) {
+	past := time.Now().UTC().Add(-time.Minute)
+	for _, r := range data.AKSRelease {
+		if r.RetryAfter != nil {
+			r.RetryAfter = &past
+		}
+	}
+}
+
+func TestReleaseCreationRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		createErrors int
+		wantState    cicd.ReleaseState
+		wantAttempts int
+		wantOutcome  cicd.DataState
+	}{
+		{
+			name:         "created on retry",
+			createErrors: 1,
+			wantState:    cicd.ReleaseStateValues.InProgress,
+			wantAttempts: 2,
+			wantOutcome:  cicd.DataStateValues.ReleaseSucceeded,
+		},
+		{
+			name:         "abandoned after the last attempt",
+			createErrors: 2,
+			wantState:    cicd.ReleaseStateValues.Abandoned,
+			wantAttempts: 2,
+			wantOutcome:  cicd.DataStateValues.ReleaseFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.AksRelease = append(config.AksRelease, &Release{DefinitionID: 11, Alias: "aks", Stagings: []string{"prod"}})
+			config.ReleaseRetry = &RetryPolicy{MaxAttempts: 2}
+			c, _, releaseClient := newTestClient(t, config)
+			ctx := context.Background()
+			releaseClient.createErrors[11] = tt.createErrors
+			data := succeededBuildDay(c)
+
+			// the day starts releasing with the release created, the failed one waits for its backoff
+			if err := c.TriggerRelease(ctx, data); err == nil {
+				t.Fatal("TriggerRelease() error = nil, want the failed creation reported")
+			}
+			if data.State != cicd.DataStateValues.ReleaseInProgress {
+				t.Fatalf("state = %s, want %s", data.State, cicd.DataStateValues.ReleaseInProgress)
+			}
+			sibling, failed := findRelease(data, "release-10"), findRelease(data, "release-11")
+			if sibling.ReleaseID == nil || sibling.State != cicd.ReleaseStateValues.InProgress {
+				t.Fatalf("release of definition 10 = %+v, want it created", sibling)
+			}
+			if failed.State != cicd.ReleaseStateValues.CreateFailed || failed.RetryAfter == nil || failed.LastError == "" {
+				t.Fatalf("release of definition 11 = %+v, want its creation failed and retried later", failed)
+			}
+			siblingID := *sibling.ReleaseID
+
+			if err := c.MonitorRelease(ctx, data); err != nil {
+				t.Fatalf("MonitorRelease() error = %v", err)
+			}
+			if failed.Attempts != 1 {
+				t.Fatalf("attempts = %d, the creation was retried before its backoff", failed.Attempts)
+			}
+
+			passBackoff(data)
+			if err := c.MonitorRelease(ctx, data); (err != nil) != (tt.wantState == cicd.ReleaseStateValues.Abandoned) {
+				t.Errorf("MonitorRelease() error = %v, want an error only for the abandoned creation", err)
+			}
+			if failed.State != tt.wantState || failed.Attempts != tt.wantAttempts {
+				t.Errorf("release of definition 11 is %s after %d attempts, want %s after %d", failed.State, failed.Attempts, tt.wantState, tt.wantAttempts)
+			}
+			if *sibling.ReleaseID != siblingID || sibling.State != cicd.ReleaseStateValues.InProgress {
+				t.Errorf("release of definition 10 = %+v, want release %d left running", sibling, siblingID)
+			}
+			if data.State != cicd.DataStateValues.ReleaseInProgress {
+				t.Fatalf("state = %s while release %d is running, want %s", data.State, siblingID, cicd.DataStateValues.ReleaseInProgress)
+			}
+
+			// the outcome of the day is decided once every definition has a release or gave up
+			for _, r := range data.AKSRelease {
+				if r.ReleaseID != nil {
+					releaseClient.setStaging(*r.ReleaseID, r.Staging[0].Name, vstsrelease.EnvironmentStatusValues.Succeeded)
+				}
+			}
+			if err := c.MonitorRelease(ctx, data); err != nil {
+				t.Fatalf("MonitorRelease() error = %v", err)
+			}
+			if data.State != tt.wantOutcome {
+				t.Errorf("state = %s, want %s", data.State, tt.wantOutcome)
+			}
+			if tt.wantOutcome == cicd.DataStateValues.ReleaseFailed && (data.Failure == nil || data.Failure.DefinitionID != 11) {
+				t.Errorf("failure = %+v, want the abandoned release of definition 11", data.Failure)
+			}
+		})
+	}
+}
+
+// wavesConfig returns releases in three waves: definition 11 soaks an hour after staging canary of
+// definition 10 succeeded, definition 12 follows the stagings of 11
+func wavesConfig() *FlowConfig {
+	config := testConfig()
+	config.AksRelease = append(config.AksRelease,
+		&Release{DefinitionID: 11, Alias: "aks", Stagings: []string{"prod"}, SoakMinutes: 60, After: []*ReleaseDependency{{DefinitionID: 10, Stagings: []string{"canary"}}}},
+		&Release{DefinitionID: 12, Alias: "aks", After: []*ReleaseDependency{{DefinitionID: 11}}},
+	)
+	return config
+}
+
+func TestReleaseWavesSoak(t *testing.T) {
+	c, _, releaseClient := newTestClient(t, wavesConfig())
+	ctx := context.Background()
+	data := succeededBuildDay(c)
+
+	if err := c.TriggerRelease(ctx, data); err != nil {
+		t.Fatalf("TriggerRelease() error = %v", err)
+	}
+	first, second, third := findRelease(data, "release-10"), findRelease(data, "release-11"), findRelease(data, "release-12")
+	if first.ReleaseID == nil || second.ReleaseID != nil || third.ReleaseID != nil {
+		t.Fatalf("created %d releases, want only the first wave", len(releaseClient.created))
+	}
+	if second.State != cicd.ReleaseStateValues.Pending {
+		t.Errorf("release of definition 11 is %s, want %s", second.State, cicd.ReleaseStateValues.Pending)
+	}
+
+	// the second wave soaks once the staging it depends on succeeded
+	releaseClient.setStaging(*first.ReleaseID, "canary", vstsrelease.EnvironmentStatusValues.Succeeded)
+	if err := c.MonitorRelease(ctx, data); err != nil {
+		t.Fatalf("MonitorRelease() error = %v", err)
+	}
+	if second.State != cicd.ReleaseStateValues.Soaking || second.ReleaseID != nil {
+		t.Fatalf("release of definition 11 = %+v, want it soaking", second)
+	}
+	if second.SoakUntil == nil || time.Until(*second.SoakUntil) < 59*time.Minute {
+		t.Errorf("release of definition 11 soaks until %v, want an hour from now", second.SoakUntil)
+	}
+	if err := c.MonitorRelease(ctx, data); err != nil {
+		t.Fatalf("MonitorRelease() error = %v", err)
+	}
+	if second.ReleaseID != nil {
+		t.Fatal("release of definition 11 was created before its soak time passed")
+	}
+
+	past := time.Now().UTC().Add(-time.Minute)
+	second.SoakUntil = &past
+	if err := c.MonitorRelease(ctx, data); err != nil {
+		t.Fatalf("MonitorRelease() error = %v", err)
+	}
+	if second.ReleaseID == nil || second.State != cicd.ReleaseStateValues.InProgress {
+		t.Fatalf("release of definition 11 = %+v, want it created after its soak time", second)
+	}
+	if third.ReleaseID != nil || third.State != cicd.ReleaseStateValues.Pending {
+		t.Errorf("release of definition 12 = %+v, want it waiting for the stagings of definition 11", third)
+	}
+
+	releaseClient.setStaging(*second.ReleaseID, "prod", vstsrelease.EnvironmentStatusValues.Succeeded)
+	if err := c.MonitorRelease(ctx, data); err != nil {
+		t.Fatalf("MonitorRelease() error = %v", err)
+	}
+	if third.ReleaseID == nil {
+		t.Fatal("release of definition 12 wasn't created after the stagings of definition 11 succeeded")
+	}
+	if len(releaseClient.created) != 3 {
+		t.Errorf("created %d releases, want one per definition", len(releaseClient.created))
+	}
+}
+
+func TestReleaseWavesStopOnFailure(t *testing.T) {
+	c, _, releaseClient := newTestClient(t, wavesConfig())
+	ctx := context.Background()
+	data := succeededBuildDay(c)
+
+	if err := c.TriggerRelease(ctx, data); err != nil {
+		t.Fatalf("TriggerRelease() error = %v", err)
+	}
+	first := findRelease(data, "release-10")
+	releaseClient.setStaging(*first.ReleaseID, "canary", vstsrelease.EnvironmentStatusValues.Rejected)
+	if err := c.MonitorRelease(ctx, data); err != nil {
+		t.Fatalf("MonitorRelease() error = %v", err)
+	}
+
+	for _, stage := range []string{"release-11", "release-12"} {
+		if r := findRelease(data, stage); r.ReleaseID != nil || r.State != cicd.ReleaseStateValues.Blocked {
+			t.Errorf("release of %s = %+v, want it blocked", stage, r)
+		}
+	}
+	if len(releaseClient.created) != 1 {
+		t.Errorf("created %d releases, want only the first wave", len(releaseClient.created))
+	}
+	if data.State != cicd.DataStateValues.ReleaseRejected {
+		t.Errorf("state = %s, want %s", data.State, cicd.DataStateValues.ReleaseRejected)
+	}
+}
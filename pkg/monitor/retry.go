@@ -0,0 +1,205 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+const (
+	defaultMaxAttempts       = 3
+	defaultBackoffMinutes    = 5
+	defaultMaxBackoffMinutes = 60
+)
+
+// defaultInfraFailurePatterns are messages of build issues which indicate the failure is caused by
+// infrastructure rather than the commit itself
+var defaultInfraFailurePatterns = []string{
+	"lost communication with the server",
+	"agent request is not running",
+	"the job running on agent",
+	"no agent found in pool",
+	"could not be found in the pool",
+	"the operation has timed out",
+	"connection reset by peer",
+	"503 service unavailable",
+	"internal server error",
+}
+
+// RetryPolicy controls how a failed build is retried
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of builds queued for a day, including the first one
+	MaxAttempts int `json:"max_attempts"`
+
+	// BackoffMinutes is the wait before the first retry, it doubles for every further attempt
+	BackoffMinutes int `json:"backoff_minutes"`
+
+	// MaxBackoffMinutes caps the wait between attempts
+	MaxBackoffMinutes int `json:"max_backoff_minutes,omitempty"`
+
+	// InfraFailuresOnly only retries builds whose issues match InfraFailurePatterns
+	InfraFailuresOnly    bool     `json:"infra_failures_only,omitempty"`
+	InfraFailurePatterns []string `json:"infra_failure_patterns,omitempty"`
+}
+
+// aksBuildRetryPolicy returns the retry policy of [EV2] AKS Build with defaults applied
+func (c *FlowConfig) aksBuildRetryPolicy() RetryPolicy {
+	return retryPolicyWithDefaults(c.AksBuildRetry)
+}
+
+// releaseRetryPolicy returns the retry policy of creating releases with defaults applied
+func (c *FlowConfig) releaseRetryPolicy() RetryPolicy {
+	return retryPolicyWithDefaults(c.ReleaseRetry)
+}
+
+func retryPolicyWithDefaults(config *RetryPolicy) RetryPolicy {
+	policy := RetryPolicy{}
+	if config != nil {
+		policy = *config
+	}
+
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+	if policy.BackoffMinutes <= 0 {
+		policy.BackoffMinutes = defaultBackoffMinutes
+	}
+	if policy.MaxBackoffMinutes <= 0 {
+		policy.MaxBackoffMinutes = defaultMaxBackoffMinutes
+	}
+	if len(policy.InfraFailurePatterns) == 0 {
+		policy.InfraFailurePatterns = defaultInfraFailurePatterns
+	}
+	return policy
+}
+
+// Backoff returns the wait before the next attempt once attempts have failed
+func (p RetryPolicy) Backoff(attempts int) time.Duration {
+	backoff := time.Duration(p.BackoffMinutes) * time.Minute
+	max := time.Duration(p.MaxBackoffMinutes) * time.Minute
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// RetryAKSBuild queues [EV2] AKS Build again after a failure according to the retry policy,
+// the build is abandoned once the policy gives up
+func (c *MonitorClient) RetryAKSBuild(ctx context.Context, data *cicd.Data) error {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action": "RetryAKSBuild",
+	})
+
+	policy := c.config.aksBuildRetryPolicy()
+	build := data.AKSBuild
+
+	if build.Count >= policy.MaxAttempts {
+		return c.abandonAKSBuild(data, fmt.Sprintf("build %d failed, given up after %d attempts", build.ID, build.Count))
+	}
+
+	// a build canceled for its timeout is retried as an infrastructure failure
+	if policy.InfraFailuresOnly && !build.TimedOut {
+		infra, err := c.isInfraFailure(ctx, build.ID, policy.InfraFailurePatterns)
+		if err != nil {
+			logger.WithError(err).Error()
+			return err
+		}
+		if !infra {
+			return c.abandonAKSBuild(data, fmt.Sprintf("build %d failed for a non-infrastructure reason", build.ID))
+		}
+	}
+
+	now := time.Now().UTC()
+	if build.RetryAfter == nil {
+		retryAfter := now.Add(policy.Backoff(build.Count))
+		build.RetryAfter = &retryAfter
+	}
+	if now.Before(*build.RetryAfter) {
+		logger.Infof("build %d failed, attempt %d/%d will be queued after %s", build.ID, build.Count+1, policy.MaxAttempts, build.RetryAfter.Format(time.RFC3339))
+		return nil
+	}
+
+	// the day can't be skipped once its build ran, the retry waits for the end of the freeze
+	if reason, frozen, err := c.frozen(data, now, logger); err != nil {
+		logger.WithError(err).Error()
+		return err
+	} else if frozen {
+		logger.Infof("build %d failed, attempt %d/%d waits for the end of freeze %q", build.ID, build.Count+1, policy.MaxAttempts, reason)
+		return nil
+	}
+
+	// the commit which failed is built again, a newer commit is only picked on the next day
+	var commit string
+	if c.flow.queueBuild.Commit != "" {
+		if data.MasterValidation == nil || data.MasterValidation.CommitID == nil {
+			err := fmt.Errorf("build %d failed but no commit is recorded to build again", build.ID)
+			logger.WithError(err).Error()
+			return err
+		}
+		commit = *data.MasterValidation.CommitID
+	}
+
+	pipelineClient, err := c.pipelineClient(logger)
+	if err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+	return c.queueAKSBuild(ctx, pipelineClient, data, commit, logger)
+}
+
+func (c *MonitorClient) abandonAKSBuild(data *cicd.Data, reason string) error {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action": "abandonAKSBuild",
+	})
+
+	data.Failure = &cicd.Failure{
+		Reason: reason,
+	}
+	if err := data.TransitionTo(cicd.DataStateValues.BuildAbandoned, reason); err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+	logger.Warnln(reason)
+	return nil
+}
+
+// isInfraFailure checks whether any issue of the build matches one of the infrastructure failure patterns
+func (c *MonitorClient) isInfraFailure(ctx context.Context, buildID int, patterns []string) (bool, error) {
+	pipelineClient, err := c.pipelineClient(c.logger)
+	if err != nil {
+		return false, err
+	}
+
+	timeline, err := pipelineClient.GetBuildTimeline(ctx, buildID)
+	if err != nil {
+		return false, err
+	}
+	if timeline == nil || timeline.Records == nil {
+		return false, nil
+	}
+
+	for _, record := range *timeline.Records {
+		if record.Issues == nil {
+			continue
+		}
+		for _, issue := range *record.Issues {
+			if issue.Message == nil {
+				continue
+			}
+			message := strings.ToLower(*issue.Message)
+			for _, p := range patterns {
+				if strings.Contains(message, strings.ToLower(p)) {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
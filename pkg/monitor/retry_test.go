@@ -0,0 +1,177 @@
+package monitor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BackoffMinutes: 5, MaxBackoffMinutes: 60}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 5 * time.Minute},
+		{2, 10 * time.Minute},
+		{3, 20 * time.Minute},
+		{4, 40 * time.Minute},
+		{5, time.Hour},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := policy.Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAKSBuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		count       int
+		infraOnly   bool
+		timedOut    bool
+		issues      []string
+		waiting     bool
+		released    bool
+		wantState   cicd.DataState
+		wantQueued  []string
+		wantFailure string
+	}{
+		{
+			name:      "waits for the backoff",
+			count:     1,
+			waiting:   true,
+			wantState: cicd.DataStateValues.BuildFailed,
+		},
+		{
+			name:       "queues the failed commit again",
+			count:      1,
+			wantState:  cicd.DataStateValues.NotStart,
+			wantQueued: []string{"abc123"},
+		},
+		{
+			name:       "queues a commit released earlier again",
+			count:      1,
+			released:   true,
+			wantState:  cicd.DataStateValues.NotStart,
+			wantQueued: []string{"abc123"},
+		},
+		{
+			name:        "gives up after the last attempt",
+			count:       3,
+			wantState:   cicd.DataStateValues.BuildAbandoned,
+			wantFailure: "given up after 3 attempts",
+		},
+		{
+			name:        "abandons a failure of the commit",
+			count:       1,
+			infraOnly:   true,
+			issues:      []string{"Test TestUpgrade timed out after 30m0s"},
+			wantState:   cicd.DataStateValues.BuildAbandoned,
+			wantFailure: "non-infrastructure reason",
+		},
+		{
+			name:       "retries an infrastructure failure",
+			count:      1,
+			infraOnly:  true,
+			issues:     []string{"We stopped hearing from agent Azure Pipelines 3. Lost communication with the server."},
+			wantState:  cicd.DataStateValues.NotStart,
+			wantQueued: []string{"abc123"},
+		},
+		{
+			name:       "retries a timed out build",
+			count:      1,
+			infraOnly:  true,
+			timedOut:   true,
+			wantState:  cicd.DataStateValues.NotStart,
+			wantQueued: []string{"abc123"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.AksBuildRetry = &RetryPolicy{MaxAttempts: 3, InfraFailuresOnly: tt.infraOnly}
+			c, pipelineClient, _ := newTestClient(t, config)
+			ctx := context.Background()
+			date := c.Today()
+
+			failed := pipelineClient.queue(2, "abc123", []string{c.buildCorrelationID(&cicd.Data{Date: date}, tt.count)})
+			pipelineClient.complete(*failed.Id, vstsbuild.BuildResultValues.Failed)
+			pipelineClient.issues[*failed.Id] = tt.issues
+			pipelineClient.validate(1, "abc123")
+			// a newer commit validated since must not replace the failed one
+			pipelineClient.validate(1, "def456")
+			pipelineClient.queued = nil
+
+			if tt.released {
+				storeEarlierDay(t, c, date, 1, cicd.DataStateValues.ReleaseSucceeded, "abc123")
+			}
+
+			commit := "abc123"
+			data := c.flow.newData(date)
+			data.State = cicd.DataStateValues.BuildFailed
+			data.MasterValidation.CommitID = &commit
+			data.AKSBuild = &cicd.AKSBuild{ID: *failed.Id, Count: tt.count, TimedOut: tt.timedOut}
+			if !tt.waiting {
+				retryAfter := time.Now().Add(-time.Minute)
+				data.AKSBuild.RetryAfter = &retryAfter
+			}
+
+			if err := c.RetryAKSBuild(ctx, data); err != nil {
+				t.Fatalf("RetryAKSBuild() error = %v", err)
+			}
+			if data.State != tt.wantState {
+				t.Errorf("state = %s, want %s", data.State, tt.wantState)
+			}
+			if strings.Join(pipelineClient.queued, ",") != strings.Join(tt.wantQueued, ",") {
+				t.Errorf("queued = %v, want %v", pipelineClient.queued, tt.wantQueued)
+			}
+			if tt.waiting && data.AKSBuild.RetryAfter == nil {
+				t.Error("no retry time was recorded")
+			}
+			if len(tt.wantQueued) > 0 && data.AKSBuild.Count != tt.count+1 {
+				t.Errorf("count = %d, want %d", data.AKSBuild.Count, tt.count+1)
+			}
+			if tt.wantFailure != "" && (data.Failure == nil || !strings.Contains(data.Failure.Reason, tt.wantFailure)) {
+				t.Errorf("failure = %+v, want it to contain %q", data.Failure, tt.wantFailure)
+			}
+		})
+	}
+}
+
+func TestIsInfraFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		issues []string
+		want   bool
+	}{
+		{name: "no issues"},
+		{name: "failed test", issues: []string{"Test TestCreateCluster failed"}},
+		{name: "test timeout", issues: []string{"panic: test timed out after 2h0m0s"}},
+		{name: "lost agent", issues: []string{"Lost communication with the server."}, want: true},
+		{name: "network timeout", issues: []string{"The operation has timed out."}, want: true},
+		{name: "any issue matches", issues: []string{"Test TestCreateCluster failed", "No agent found in pool Hosted"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, pipelineClient, _ := newTestClient(t, testConfig())
+			pipelineClient.issues[1] = tt.issues
+
+			got, err := c.isInfraFailure(context.Background(), 1, c.config.aksBuildRetryPolicy().InfraFailurePatterns)
+			if err != nil {
+				t.Fatalf("isInfraFailure() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("isInfraFailure() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package monitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultPollIntervalMinutes = 5
+
+// ScheduleConfig describes when the monitor works on a day and which commit it picks
+type ScheduleConfig struct {
+	// PollIntervalMinutes is the interval between cycles
+	PollIntervalMinutes int `json:"poll_interval_minutes,omitempty"`
+
+	// Timezone is the IANA name of the timezone of the business day, e.g. America/Los_Angeles, defaults to UTC
+	Timezone string `json:"timezone,omitempty"`
+
+	// Trigger is a cron expression "minute hour day-of-month month day-of-week" in Timezone, the day
+	// starts at its first match of the day and days without a match are skipped
+	Trigger string `json:"trigger,omitempty"`
+
+	// Cutoff is the time of the day "HH:MM" in Timezone, only builds validated before it are picked
+	Cutoff string `json:"cutoff,omitempty"`
+}
+
+// schedule is the parsed ScheduleConfig of a flow
+type schedule struct {
+	pollInterval time.Duration
+	location     *time.Location
+	trigger      *cronSpec
+
+	// cutoff is the offset of the cutoff from the start of the day, negative if not set
+	cutoff time.Duration
+}
+
+// buildSchedule parses the schedule of config, the day starts at UTC midnight if not set
+func buildSchedule(config *ScheduleConfig) (*schedule, error) {
+	s := &schedule{
+		pollInterval: defaultPollIntervalMinutes * time.Minute,
+		location:     time.UTC,
+		cutoff:       -1,
+	}
+	if config == nil {
+		return s, nil
+	}
+
+	if config.PollIntervalMinutes > 0 {
+		s.pollInterval = time.Duration(config.PollIntervalMinutes) * time.Minute
+	}
+	if config.Timezone != "" {
+		location, err := time.LoadLocation(config.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+		s.location = location
+	}
+	if config.Trigger != "" {
+		trigger, err := parseCron(config.Trigger)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trigger: %w", err)
+		}
+		s.trigger = trigger
+	}
+	if config.Cutoff != "" {
+		cutoff, err := time.Parse("15:04", config.Cutoff)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cutoff: %w", err)
+		}
+		s.cutoff = time.Duration(cutoff.Hour())*time.Hour + time.Duration(cutoff.Minute())*time.Minute
+	}
+	return s, nil
+}
+
+// date returns the business day of t
+func (s *schedule) date(t time.Time) string {
+	return t.In(s.location).Format(dateFormat)
+}
+
+// startOfDay returns the beginning of the business day date
+func (s *schedule) startOfDay(date string) (time.Time, error) {
+	return time.ParseInLocation(dateFormat, date, s.location)
+}
+
+// startTime returns when the work on the day date starts, false if the day is skipped. The day
+// starts at the first match of the trigger, or at the cutoff, or at the beginning of the day.
+func (s *schedule) startTime(date string) (time.Time, bool, error) {
+	day, err := s.startOfDay(date)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if s.trigger != nil {
+		for t := day; s.date(t) == date; t = t.Add(time.Minute) {
+			if s.trigger.matches(t.In(s.location)) {
+				return t, true, nil
+			}
+		}
+		return time.Time{}, false, nil
+	}
+	if s.cutoff >= 0 {
+		return day.Add(s.cutoff), true, nil
+	}
+	return day, true, nil
+}
+
+// pickWindow returns the range of finish times of the builds which may be picked on the day date at
+// now: the day before the cutoff, or since the beginning of the previous day if there is no cutoff
+func (s *schedule) pickWindow(date string, now time.Time) (time.Time, time.Time, error) {
+	day, err := s.startOfDay(date)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if s.cutoff < 0 {
+		return day.AddDate(0, 0, -1), time.Time{}, nil
+	}
+	cutoff := day.Add(s.cutoff)
+	if now.Before(cutoff) {
+		return cutoff.AddDate(0, 0, -1), now, nil
+	}
+	return cutoff.AddDate(0, 0, -1), cutoff, nil
+}
+
+// cronSpec is a parsed cron expression, each field holds the allowed values
+type cronSpec struct {
+	minutes, hours, daysOfMonth, months, daysOfWeek map[int]bool
+}
+
+// parseCron parses the five fields of a cron expression, each field may be *, a value, a range
+// a-b, a list of those separated by commas, and have a step /n
+func parseCron(expression string) (*cronSpec, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%q must have 5 fields", expression)
+	}
+
+	// day-of-week accepts 7 for Sunday as well as 0
+	bounds := [][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := make([]map[int]bool, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("field %q of %q: %w", field, expression, err)
+		}
+		sets[i] = set
+	}
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+	return &cronSpec{
+		minutes:     sets[0],
+		hours:       sets[1],
+		daysOfMonth: sets[2],
+		months:      sets[3],
+		daysOfWeek:  sets[4],
+	}, nil
+}
+
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		step, stepped := 1, false
+		if i := strings.Index(part, "/"); i >= 0 {
+			stepped = true
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", bounds[0])
+			}
+			to = from
+			if stepped {
+				to = max
+			}
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", bounds[1])
+				}
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, fmt.Errorf("%d-%d is out of range %d-%d", from, to, min, max)
+		}
+
+		for v := from; v <= to; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// matches checks whether the minute of t matches the expression
+func (s *cronSpec) matches(t time.Time) bool {
+	return s.minutes[t.Minute()] &&
+		s.hours[t.Hour()] &&
+		s.daysOfMonth[t.Day()] &&
+		s.months[int(t.Month())] &&
+		s.daysOfWeek[int(t.Weekday())]
+}
@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	at := func(value string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		expression string
+		wantErr    bool
+		matches    []string
+		misses     []string
+	}{
+		{
+			expression: "0 9 * * *",
+			matches:    []string{"2021-03-01 09:00", "2021-03-06 09:00"},
+			misses:     []string{"2021-03-01 09:01", "2021-03-01 10:00"},
+		},
+		{
+			expression: "30 8-10 * * 1-5",
+			matches:    []string{"2021-03-01 08:30", "2021-03-05 10:30"},
+			misses:     []string{"2021-03-06 08:30", "2021-03-01 11:30"},
+		},
+		{
+			expression: "*/15 * * * *",
+			matches:    []string{"2021-03-01 00:00", "2021-03-01 13:45"},
+			misses:     []string{"2021-03-01 13:50"},
+		},
+		{
+			// 7 is Sunday as well as 0
+			expression: "0 0 * * 7",
+			matches:    []string{"2021-03-07 00:00"},
+			misses:     []string{"2021-03-06 00:00"},
+		},
+		{
+			expression: "0 0 1,15 3 *",
+			matches:    []string{"2021-03-01 00:00", "2021-03-15 00:00"},
+			misses:     []string{"2021-04-01 00:00", "2021-03-02 00:00"},
+		},
+		{expression: "0 9 * *", wantErr: true},
+		{expression: "60 9 * * *", wantErr: true},
+		{expression: "0 9-8 * * *", wantErr: true},
+		{expression: "*/0 * * * *", wantErr: true},
+		{expression: "a * * * *", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		spec, err := parseCron(tt.expression)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCron(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			continue
+		}
+		for _, m := range tt.matches {
+			if !spec.matches(at(m)) {
+				t.Errorf("%q doesn't match %s", tt.expression, m)
+			}
+		}
+		for _, m := range tt.misses {
+			if spec.matches(at(m)) {
+				t.Errorf("%q matches %s", tt.expression, m)
+			}
+		}
+	}
+}
+
+func TestScheduleStartTime(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        *ScheduleConfig
+		date          string
+		want          string
+		wantScheduled bool
+	}{
+		{
+			name:          "midnight UTC by default",
+			date:          "2021-03-01",
+			want:          "2021-03-01T00:00:00Z",
+			wantScheduled: true,
+		},
+		{
+			name:          "cutoff",
+			config:        &ScheduleConfig{Cutoff: "06:30"},
+			date:          "2021-03-01",
+			want:          "2021-03-01T06:30:00Z",
+			wantScheduled: true,
+		},
+		{
+			name:          "trigger in timezone",
+			config:        &ScheduleConfig{Trigger: "0 9 * * 1-5", Timezone: "Asia/Shanghai"},
+			date:          "2021-03-01",
+			want:          "2021-03-01T01:00:00Z",
+			wantScheduled: true,
+		},
+		{
+			name:   "no trigger match",
+			config: &ScheduleConfig{Trigger: "0 9 * * 1-5", Timezone: "Asia/Shanghai"},
+			date:   "2021-03-06",
+		},
+		{
+			name:          "trigger over a DST change",
+			config:        &ScheduleConfig{Trigger: "0 9 * * *", Timezone: "America/Los_Angeles"},
+			date:          "2021-03-14",
+			want:          "2021-03-14T16:00:00Z",
+			wantScheduled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := buildSchedule(tt.config)
+			if err != nil {
+				t.Fatalf("buildSchedule() error = %v", err)
+			}
+			got, scheduled, err := s.startTime(tt.date)
+			if err != nil {
+				t.Fatalf("startTime() error = %v", err)
+			}
+			if scheduled != tt.wantScheduled {
+				t.Fatalf("startTime() scheduled = %v, want %v", scheduled, tt.wantScheduled)
+			}
+			if scheduled && got.UTC().Format(time.RFC3339) != tt.want {
+				t.Errorf("startTime() = %s, want %s", got.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildScheduleErrors(t *testing.T) {
+	for _, config := range []*ScheduleConfig{
+		{Timezone: "Mars/Olympus"},
+		{Trigger: "every day"},
+		{Cutoff: "25:00"},
+	} {
+		if _, err := buildSchedule(config); err == nil {
+			t.Errorf("buildSchedule(%+v) succeeded, want an error", config)
+		}
+	}
+}
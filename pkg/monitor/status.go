@@ -0,0 +1,234 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/metrics"
+)
+
+const (
+	readinessCacheDuration = time.Minute
+	livenessSlack          = time.Minute
+	serverShutdownTimeout  = 10 * time.Second
+)
+
+// CycleStatus describes the latest finished cycle of the monitor loop
+type CycleStatus struct {
+	StartTime  time.Time `json:"start_time"`
+	FinishTime time.Time `json:"finish_time"`
+	Errors     []string  `json:"errors,omitempty"`
+}
+
+// Status is the status of a flow reported by the /status endpoint
+type Status struct {
+	Flow      string       `json:"flow"`
+	Leader    bool         `json:"leader"`
+	Date      string       `json:"date"`
+	Data      *cicd.Data   `json:"data,omitempty"`
+	LastCycle *CycleStatus `json:"last_cycle,omitempty"`
+	NextCycle *time.Time   `json:"next_cycle,omitempty"`
+}
+
+// loopStatus keeps track of the monitor loop for the status endpoints
+type loopStatus struct {
+	mu        sync.RWMutex
+	lastCycle *CycleStatus
+	nextCycle time.Time
+	deadline  time.Time
+
+	readyAt  time.Time
+	readyErr error
+}
+
+func (s *loopStatus) scheduleCycle(next time.Time, deadline time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextCycle = next
+	s.deadline = deadline
+}
+
+func (s *loopStatus) finishCycle(start time.Time, errs ...error) {
+	cycle := &CycleStatus{
+		StartTime:  start,
+		FinishTime: time.Now().UTC(),
+	}
+	for _, err := range errs {
+		if err != nil {
+			cycle.Errors = append(cycle.Errors, err.Error())
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastCycle = cycle
+}
+
+// alive checks whether the loop ticked in time, the loop is alive until the deadline of the scheduled cycle passed
+func (s *loopStatus) alive(now time.Time) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.deadline.IsZero() || now.Before(s.deadline) {
+		return nil
+	}
+	return fmt.Errorf("cycle scheduled at %s hasn't finished by %s", s.nextCycle.Format(time.RFC3339), s.deadline.Format(time.RFC3339))
+}
+
+// Serve runs the HTTP status server on address until ctx is canceled
+func (m *Monitor) Serve(ctx context.Context, address string) error {
+	logger := m.logger.WithFields(logrus.Fields{
+		"action":  "Serve",
+		"address": address,
+	})
+
+	server := &http.Server{
+		Addr:    address,
+		Handler: m.Handler(),
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logger.WithError(err).Error()
+		}
+	}()
+
+	logger.Infoln("status server is listening")
+	err := server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Handler returns the HTTP handler of the status endpoints, health and readiness require every
+// flow to be healthy and ready, /status reports every flow or the one selected by ?flow=<name>.
+// The endpoints are read-only, followers serve them as well as the leader.
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", m.handleHealthz)
+	mux.HandleFunc("/readyz", m.handleReadyz)
+	mux.HandleFunc("/status", m.handleStatus)
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
+func (m *Monitor) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	for _, c := range m.clients {
+		if err := c.status.alive(now); err != nil {
+			http.Error(w, fmt.Sprintf("flow %s: %s", c.config.name(), err), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (m *Monitor) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	for _, c := range m.clients {
+		if err := c.ready(r.Context()); err != nil {
+			http.Error(w, fmt.Sprintf("flow %s: %s", c.config.name(), err), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (m *Monitor) handleStatus(w http.ResponseWriter, r *http.Request) {
+	var response interface{}
+	if name := r.URL.Query().Get("flow"); name != "" {
+		c, err := m.Client(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		status, err := c.Status(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		status.Leader = m.isLeader()
+		response = status
+	} else {
+		statuses := []*Status{}
+		for _, c := range m.clients {
+			status, err := c.Status(r.Context())
+			if err != nil {
+				http.Error(w, fmt.Sprintf("flow %s: %s", c.config.name(), err), http.StatusServiceUnavailable)
+				return
+			}
+			status.Leader = m.isLeader()
+			statuses = append(statuses, status)
+		}
+		response = statuses
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	encoder.Encode(response)
+}
+
+// Status returns the data of today and the state of the monitor loop of the flow
+func (c *MonitorClient) Status(ctx context.Context) (*Status, error) {
+	date := c.Today()
+	data, _, err := c.GetDataFromBlob(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{
+		Flow: c.config.name(),
+		Date: date,
+		Data: data,
+	}
+	c.status.mu.RLock()
+	status.LastCycle = c.status.lastCycle
+	if !c.status.nextCycle.IsZero() {
+		next := c.status.nextCycle
+		status.NextCycle = &next
+	}
+	c.status.mu.RUnlock()
+	return status, nil
+}
+
+// ready checks whether the state store and Azure DevOps are reachable, the result is cached for a while
+func (c *MonitorClient) ready(ctx context.Context) error {
+	c.status.mu.RLock()
+	readyAt, readyErr := c.status.readyAt, c.status.readyErr
+	c.status.mu.RUnlock()
+	if time.Since(readyAt) < readinessCacheDuration {
+		return readyErr
+	}
+
+	err := c.checkDependencies(ctx)
+
+	c.status.mu.Lock()
+	c.status.readyAt = time.Now()
+	c.status.readyErr = err
+	c.status.mu.Unlock()
+	return err
+}
+
+func (c *MonitorClient) checkDependencies(ctx context.Context) error {
+	if err := c.store.Ping(ctx); err != nil {
+		return fmt.Errorf("state store is not reachable: %w", err)
+	}
+
+	pipelineClient, err := c.pipelineClient(c.logger)
+	if err != nil {
+		return err
+	}
+	if _, err := pipelineClient.GetPipelineByID(ctx, c.flow.buildStage().PipelineID); err != nil {
+		return fmt.Errorf("azure devops is not reachable: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+// serve sends a GET request of target to the status handler of m
+func serve(m *Monitor, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+func TestHandleHealthz(t *testing.T) {
+	tests := []struct {
+		name     string
+		deadline time.Duration
+		want     int
+	}{
+		{name: "no cycle scheduled yet", want: http.StatusOK},
+		{name: "cycle before its deadline", deadline: time.Minute, want: http.StatusOK},
+		{name: "cycle past its deadline", deadline: -time.Minute, want: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _, _ := newTestClient(t, testConfig())
+			if tt.deadline != 0 {
+				now := time.Now()
+				c.status.scheduleCycle(now, now.Add(tt.deadline))
+			}
+
+			response := serve(&Monitor{clients: []*MonitorClient{c}, logger: c.logger}, "/healthz")
+			if response.Code != tt.want {
+				t.Errorf("status code = %d, want %d: %s", response.Code, tt.want, response.Body)
+			}
+		})
+	}
+}
+
+func TestHandleReadyz(t *testing.T) {
+	tests := []struct {
+		name        string
+		unreachable bool
+		want        int
+	}{
+		{name: "dependencies reachable", want: http.StatusOK},
+		{name: "azure devops unreachable", unreachable: true, want: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, pipelineClient, _ := newTestClient(t, testConfig())
+			pipelineClient.unreachable = tt.unreachable
+
+			response := serve(&Monitor{clients: []*MonitorClient{c}, logger: c.logger}, "/readyz")
+			if response.Code != tt.want {
+				t.Errorf("status code = %d, want %d: %s", response.Code, tt.want, response.Body)
+			}
+			if tt.unreachable && !strings.Contains(response.Body.String(), "azure devops is not reachable") {
+				t.Errorf("body = %q, want the unreachable dependency", response.Body)
+			}
+		})
+	}
+}
+
+func TestHandleStatus(t *testing.T) {
+	first, pipelineClient, _ := newTestClient(t, testConfig())
+	pipelineClient.validate(1, "abc123")
+	if _, err := first.reconcile(context.Background()); err != nil {
+		t.Fatalf("reconcile() error = %v", err)
+	}
+	config := testConfig()
+	config.Name = "second"
+	second, _, _ := newTestClient(t, config)
+	m := &Monitor{clients: []*MonitorClient{first, second}, logger: first.logger}
+
+	response := serve(m, "/status")
+	if response.Code != http.StatusOK {
+		t.Fatalf("status code = %d, want %d: %s", response.Code, http.StatusOK, response.Body)
+	}
+	var statuses []*Status
+	if err := json.Unmarshal(response.Body.Bytes(), &statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].Flow != "test" || statuses[1].Flow != "second" {
+		t.Fatalf("statuses = %+v, want the status of both flows", statuses)
+	}
+	if !statuses[0].Leader || statuses[0].LastCycle == nil || statuses[0].Data.State != cicd.DataStateValues.NotStart {
+		t.Errorf("status of flow test = %+v, want the leader with the cycle which queued the build", statuses[0])
+	}
+
+	response = serve(m, "/status?flow=second")
+	var status Status
+	if err := json.Unmarshal(response.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if response.Code != http.StatusOK || status.Flow != "second" || status.Data.State != cicd.DataStateValues.None {
+		t.Errorf("status of flow second = %d %+v", response.Code, status)
+	}
+
+	if response = serve(m, "/status?flow=missing"); response.Code != http.StatusNotFound {
+		t.Errorf("status code of an unknown flow = %d, want %d", response.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCycleTimeoutMinutes      = 10
+	defaultMaxConsecutiveFailures   = 10
+	defaultFailureBackoffSeconds    = 30
+	defaultMaxFailureBackoffMinutes = 30
+	defaultShutdownGraceSeconds     = 30
+	persistTimeout                  = 30 * time.Second
+)
+
+// SupervisorConfig controls how the monitor loop reacts to failed cycles
+type SupervisorConfig struct {
+	// CycleTimeoutMinutes bounds the duration of a single cycle
+	CycleTimeoutMinutes int `json:"cycle_timeout_minutes,omitempty"`
+
+	// MaxConsecutiveFailures is the number of failed cycles in a row after which the loop gives up
+	MaxConsecutiveFailures int `json:"max_consecutive_failures,omitempty"`
+
+	// FailureBackoffSeconds is the wait after the first failed cycle, it doubles for every further failure
+	FailureBackoffSeconds int `json:"failure_backoff_seconds,omitempty"`
+
+	// MaxFailureBackoffMinutes caps the wait after failed cycles
+	MaxFailureBackoffMinutes int `json:"max_failure_backoff_minutes,omitempty"`
+
+	// ShutdownGraceSeconds is how long an in-flight cycle may keep running after shutdown is requested,
+	// the cycle is canceled without grace when the leader lease is lost
+	ShutdownGraceSeconds int `json:"shutdown_grace_seconds,omitempty"`
+}
+
+// supervisorConfig returns the supervisor config with defaults applied
+func (c *Config) supervisorConfig() SupervisorConfig {
+	config := SupervisorConfig{}
+	if c.Supervisor != nil {
+		config = *c.Supervisor
+	}
+
+	if config.CycleTimeoutMinutes <= 0 {
+		config.CycleTimeoutMinutes = defaultCycleTimeoutMinutes
+	}
+	if config.MaxConsecutiveFailures <= 0 {
+		config.MaxConsecutiveFailures = defaultMaxConsecutiveFailures
+	}
+	if config.FailureBackoffSeconds <= 0 {
+		config.FailureBackoffSeconds = defaultFailureBackoffSeconds
+	}
+	if config.MaxFailureBackoffMinutes <= 0 {
+		config.MaxFailureBackoffMinutes = defaultMaxFailureBackoffMinutes
+	}
+	if config.ShutdownGraceSeconds <= 0 {
+		config.ShutdownGraceSeconds = defaultShutdownGraceSeconds
+	}
+	return config
+}
+
+// failureBackoff returns the wait before the next cycle after failures cycles failed in a row
+func (c SupervisorConfig) failureBackoff(failures int) time.Duration {
+	backoff := time.Duration(c.FailureBackoffSeconds) * time.Second
+	max := time.Duration(c.MaxFailureBackoffMinutes) * time.Minute
+	for i := 1; i < failures && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// MonitorRoutine reconciles the CI/CD process every poll interval until ctx is canceled. Failed cycles
+// are retried with exponential backoff, an error is returned once too many cycles failed in a row
+// so that the process exits and gets restarted.
+func (c *MonitorClient) MonitorRoutine(ctx context.Context) error {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action": "MonitorRoutine",
+	})
+
+	config := c.supervisor
+
+	failures := 0
+	var wait time.Duration
+	for {
+		next := time.Now().UTC().Add(wait)
+		c.status.scheduleCycle(next, next.Add(time.Duration(config.CycleTimeoutMinutes)*time.Minute+livenessSlack))
+
+		select {
+		case <-ctx.Done():
+			logger.Infoln("monitor is stopped")
+			c.status.scheduleCycle(time.Time{}, time.Time{})
+			return nil
+		case <-time.After(wait):
+		}
+
+		cycleCtx, cancel := cycleContext(ctx, config)
+		err := c.Reconcile(cycleCtx)
+		cancel()
+
+		if err == nil {
+			failures = 0
+			wait = c.schedule.pollInterval
+			continue
+		}
+
+		failures++
+		if failures >= config.MaxConsecutiveFailures {
+			return fmt.Errorf("%d consecutive cycles failed: %w", failures, err)
+		}
+		wait = config.failureBackoff(failures)
+		logger.WithError(err).Warnf("cycle failed %d/%d times in a row, next cycle in %s", failures, config.MaxConsecutiveFailures, wait)
+	}
+}
+
+// cycleContext returns the context of a single cycle. It isn't canceled as soon as the root context
+// is, the in-flight cycle gets the shutdown grace period to finish its calls. A cycle of a leader
+// which lost its lease is canceled right away, another replica may already lead.
+func cycleContext(root context.Context, config SupervisorConfig) (context.Context, context.CancelFunc) {
+	// the lease of root is kept so that the cycle doesn't persist anything once it is lost
+	base := context.Background()
+	if lost := root.Value(leaseLostKey{}); lost != nil {
+		base = context.WithValue(base, leaseLostKey{}, lost)
+	}
+	ctx, cancel := context.WithTimeout(base, time.Duration(config.CycleTimeoutMinutes)*time.Minute)
+	lost := leaseLost(root)
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-lost:
+			cancel()
+			return
+		case <-root.Done():
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-lost:
+			cancel()
+		case <-time.After(time.Duration(config.ShutdownGraceSeconds) * time.Second):
+			cancel()
+		}
+	}()
+	return ctx, cancel
+}
+
+// persistContext returns ctx, or a short-lived context if ctx is already done, so that the data is
+// still persisted when the cycle timed out or ran out of shutdown grace. errLeaseLost is returned
+// once the leader lease of ctx is lost, the data of a replica which no longer leads isn't persisted.
+func persistContext(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	if isLeaseLost(ctx) {
+		return nil, nil, errLeaseLost
+	}
+	if ctx.Err() == nil {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), persistTimeout)
+	return ctx, cancel, nil
+}
@@ -0,0 +1,191 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+func TestMonitorRoutineCycle(t *testing.T) {
+	c, pipelineClient, _ := newTestClient(t, testConfig())
+	pipelineClient.validate(1, "abc123")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.MonitorRoutine(ctx)
+	}()
+
+	// the first cycle runs immediately, the next one only after the poll interval
+	deadline := time.Now().Add(5 * time.Second)
+	var data *cicd.Data
+	for time.Now().Before(deadline) {
+		d, _, err := c.store.GetData(ctx, c.blobName(c.Today()))
+		if err == nil {
+			data = d
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("MonitorRoutine() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("MonitorRoutine() didn't stop once its context was canceled")
+	}
+
+	if data == nil {
+		t.Fatal("the first cycle didn't persist the data of the day")
+	}
+	if data.State != cicd.DataStateValues.NotStart {
+		t.Errorf("state = %s, want %s", data.State, cicd.DataStateValues.NotStart)
+	}
+	if len(pipelineClient.queued) != 1 || pipelineClient.queued[0] != "abc123" {
+		t.Errorf("queued = %v, want the build of abc123", pipelineClient.queued)
+	}
+	if data.AKSBuild == nil || data.AKSBuild.Count != 1 {
+		t.Errorf("build = %+v, want the first attempt", data.AKSBuild)
+	}
+}
+
+func TestFailureBackoff(t *testing.T) {
+	config := SupervisorConfig{FailureBackoffSeconds: 30, MaxFailureBackoffMinutes: 2}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{10, 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := config.failureBackoff(tt.failures); got != tt.want {
+			t.Errorf("failureBackoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestCycleContext(t *testing.T) {
+	config := SupervisorConfig{CycleTimeoutMinutes: 10, ShutdownGraceSeconds: 60}
+
+	tests := []struct {
+		name      string
+		loseLease bool
+		wantDone  bool
+	}{
+		{name: "shutdown gives the cycle a grace period", wantDone: false},
+		{name: "lost lease cancels the cycle", loseLease: true, wantDone: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lost := make(chan struct{})
+			root, cancelRoot := context.WithCancel(context.WithValue(context.Background(), leaseLostKey{}, lost))
+			ctx, cancel := cycleContext(root, config)
+			defer cancel()
+
+			if tt.loseLease {
+				close(lost)
+			}
+			cancelRoot()
+
+			select {
+			case <-ctx.Done():
+				if !tt.wantDone {
+					t.Fatal("cycle context canceled before the grace period")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantDone {
+					t.Fatal("cycle context not canceled")
+				}
+			}
+		})
+	}
+}
+
+func TestCycleContextLeaseLostDuringGrace(t *testing.T) {
+	lost := make(chan struct{})
+	root, cancelRoot := context.WithCancel(context.WithValue(context.Background(), leaseLostKey{}, lost))
+	ctx, cancel := cycleContext(root, SupervisorConfig{CycleTimeoutMinutes: 10, ShutdownGraceSeconds: 60})
+	defer cancel()
+
+	cancelRoot()
+	time.Sleep(10 * time.Millisecond)
+	close(lost)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("cycle context not canceled once the lease was lost")
+	}
+}
+
+func TestPersistContext(t *testing.T) {
+	tests := []struct {
+		name      string
+		timedOut  bool
+		loseLease bool
+		wantErr   error
+	}{
+		{name: "running cycle"},
+		{name: "timed out cycle", timedOut: true},
+		{name: "lost lease", loseLease: true, wantErr: errLeaseLost},
+		{name: "timed out cycle of a lost lease", timedOut: true, loseLease: true, wantErr: errLeaseLost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lost := make(chan struct{})
+			ctx, cancel := context.WithCancel(context.WithValue(context.Background(), leaseLostKey{}, lost))
+			defer cancel()
+			if tt.timedOut {
+				cancel()
+			}
+			if tt.loseLease {
+				close(lost)
+			}
+
+			persistCtx, persistCancel, err := persistContext(ctx)
+			if err != tt.wantErr {
+				t.Fatalf("persistContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer persistCancel()
+			if persistCtx.Err() != nil {
+				t.Errorf("persist context is done: %v", persistCtx.Err())
+			}
+		})
+	}
+}
+
+// TestReconcileLeaseLost checks a cycle interrupted by the loss of the lease doesn't persist its data
+func TestReconcileLeaseLost(t *testing.T) {
+	c, pipelineClient, _ := newTestClient(t, testConfig())
+	pipelineClient.validate(1, "abc123")
+
+	lost := make(chan struct{})
+	root := context.WithValue(context.Background(), leaseLostKey{}, lost)
+	ctx, cancel := cycleContext(root, SupervisorConfig{CycleTimeoutMinutes: 10, ShutdownGraceSeconds: 60})
+	defer cancel()
+	close(lost)
+	<-ctx.Done()
+
+	if _, err := c.reconcile(ctx); !errors.Is(err, errLeaseLost) {
+		t.Errorf("reconcile() error = %v, want %v", err, errLeaseLost)
+	}
+	if _, _, err := c.store.GetData(context.Background(), c.blobName(c.Today())); !errors.Is(err, statestore.ErrNotFound) {
+		t.Errorf("data of the day was persisted after the lease was lost, error = %v", err)
+	}
+}
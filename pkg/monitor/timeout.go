@@ -0,0 +1,172 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/pipelines"
+	"github.com/yangzuo0621/monitor/pkg/releases"
+)
+
+// TimeoutConfig sets the timeouts of the legacy chain of stages
+type TimeoutConfig struct {
+	// BuildMinutes is the time [EV2] AKS Build may take from being queued, no timeout if zero
+	BuildMinutes int `json:"build_minutes,omitempty"`
+
+	// RetryBuild queues the build again after a timeout according to AksBuildRetry
+	RetryBuild bool `json:"retry_build,omitempty"`
+
+	// StagingMinutes is the time each staging may take from being started, no timeout if zero
+	StagingMinutes int `json:"staging_minutes,omitempty"`
+
+	// RetryStaging deploys the staging again after a timeout according to ReleaseRetry
+	RetryStaging bool `json:"retry_staging,omitempty"`
+}
+
+// timeout returns the timeout of the stage, zero if none
+func (s *Stage) timeout() time.Duration {
+	return time.Duration(s.TimeoutMinutes) * time.Minute
+}
+
+// timeoutAKSBuild cancels the build if it has run longer than the timeout of its stage. The build
+// fails so that it's retried if the stage retries on timeout and attempts are left, the day is
+// timed out otherwise. true is returned if the build timed out.
+func (c *MonitorClient) timeoutAKSBuild(
+	ctx context.Context,
+	pipelineClient pipelines.PipelineClient,
+	data *cicd.Data,
+	build *vstsbuild.Build,
+	logger logrus.FieldLogger,
+) (bool, error) {
+	stage := c.flow.queueBuild
+	if stage == nil || stage.timeout() == 0 || *build.Status == vstsbuild.BuildStatusValues.Completed {
+		return false, nil
+	}
+
+	queued := data.AKSBuild.QueueTime
+	if queued == nil {
+		queued = timeOf(build.QueueTime)
+	}
+	if queued == nil || time.Since(*queued) < stage.timeout() {
+		return false, nil
+	}
+
+	if err := pipelineClient.CancelBuild(ctx, data.AKSBuild.ID); err != nil {
+		return false, err
+	}
+
+	status := string(vstsbuild.BuildStatusValues.Cancelling)
+	data.AKSBuild.BuildStatus = &status
+	data.AKSBuild.TimedOut = true
+	reason := fmt.Sprintf("build %d timed out after %s and was canceled", data.AKSBuild.ID, stage.timeout())
+	logger.Warnln(reason)
+
+	if stage.RetryOnTimeout && data.AKSBuild.Count < c.config.aksBuildRetryPolicy().MaxAttempts {
+		return true, data.TransitionTo(cicd.DataStateValues.BuildFailed, reason)
+	}
+	data.Failure = &cicd.Failure{
+		Reason: reason,
+	}
+	return true, data.TransitionTo(cicd.DataStateValues.BuildTimedOut, reason)
+}
+
+// timeoutStaging abandons the deployment of the staging if it has run longer than the timeout of
+// its stage. The staging is deployed again later if the stage retries on timeout and attempts are
+// left, it is recorded as timed out otherwise.
+func (c *MonitorClient) timeoutStaging(
+	ctx context.Context,
+	releaseClient releases.ReleaseClient,
+	release *cicd.AKSRelease,
+	staging *cicd.Staging,
+	environment *vstsrelease.ReleaseEnvironment,
+	logger logrus.FieldLogger,
+) error {
+	stage, ok := c.flow.byName[staging.Stage]
+	if !ok || stage.timeout() == 0 || staging.Status == nil || environment.Id == nil {
+		return nil
+	}
+	if !stagingRunning(*staging.Status) {
+		return nil
+	}
+
+	started := staging.StartTime
+	if started == nil {
+		started = release.StartTime
+	}
+	if staging.RetriedAt != nil {
+		// the start of a staging is of its first deployment, a retry gets the whole timeout again
+		started = staging.RetriedAt
+	}
+	if started == nil || time.Since(*started) < stage.timeout() {
+		return nil
+	}
+
+	reason := fmt.Sprintf("staging %s of release %d timed out after %s", staging.Name, *release.ReleaseID, stage.timeout())
+	if err := releaseClient.CancelReleaseEnvironment(ctx, *release.ReleaseID, *environment.Id, reason); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	logger.Warnln(reason)
+
+	policy := c.config.releaseRetryPolicy()
+	if stage.RetryOnTimeout && staging.TimeoutRetries+1 < policy.MaxAttempts {
+		staging.TimeoutRetries++
+		retryAfter := now.Add(policy.Backoff(staging.TimeoutRetries))
+		staging.RetryAfter = &retryAfter
+		status := cicd.StagingStatusRetryPending
+		staging.Status = &status
+		logger.Infof("staging %s is deployed again after %s, attempt %d/%d", staging.Name, retryAfter.Format(time.RFC3339), staging.TimeoutRetries+1, policy.MaxAttempts)
+		return nil
+	}
+
+	status := cicd.StagingStatusTimedOut
+	staging.Status = &status
+	staging.FinishTime = &now
+	return nil
+}
+
+// retryStaging deploys a staging which timed out again, once its backoff passed and its abandoned
+// deployment stopped. No deployment is started during a freeze.
+func (c *MonitorClient) retryStaging(
+	ctx context.Context,
+	releaseClient releases.ReleaseClient,
+	data *cicd.Data,
+	release *cicd.AKSRelease,
+	staging *cicd.Staging,
+	environment *vstsrelease.ReleaseEnvironment,
+	logger logrus.FieldLogger,
+) error {
+	now := time.Now().UTC()
+	if staging.RetryAfter != nil && now.Before(*staging.RetryAfter) {
+		logger.Infof("staging %s timed out, it is deployed again after %s", staging.Name, staging.RetryAfter.Format(time.RFC3339))
+		return nil
+	}
+	if environment.Id == nil || (environment.Status != nil && stagingRunning(string(*environment.Status))) {
+		logger.Infof("staging %s timed out, waiting for its deployment to be abandoned", staging.Name)
+		return nil
+	}
+	if reason, frozen, err := c.frozen(data, now, logger); err != nil {
+		return err
+	} else if frozen {
+		logger.Infof("staging %s isn't deployed again during freeze %q", staging.Name, reason)
+		return nil
+	}
+
+	comment := fmt.Sprintf("deployed again by the monitor for %s after a timeout", data.Date)
+	if err := releaseClient.DeployReleaseEnvironment(ctx, *release.ReleaseID, *environment.Id, comment); err != nil {
+		return err
+	}
+	status := string(vstsrelease.EnvironmentStatusValues.Queued)
+	staging.Status = &status
+	staging.FinishTime = nil
+	staging.RetryAfter = nil
+	staging.RetriedAt = &now
+	logger.Infof("deployed staging %s of release %d again", staging.Name, *release.ReleaseID)
+	return nil
+}
@@ -0,0 +1,239 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/statestore"
+)
+
+func TestTimeoutAKSBuild(t *testing.T) {
+	tests := []struct {
+		name         string
+		queuedAgo    time.Duration
+		retry        bool
+		count        int
+		wantTimedOut bool
+		wantState    cicd.DataState
+	}{
+		{
+			name:      "build within its timeout",
+			queuedAgo: 10 * time.Minute,
+			count:     1,
+			wantState: cicd.DataStateValues.BuildInProgress,
+		},
+		{
+			name:         "build timed out",
+			queuedAgo:    time.Hour,
+			count:        1,
+			wantTimedOut: true,
+			wantState:    cicd.DataStateValues.BuildTimedOut,
+		},
+		{
+			name:         "build timed out with attempts left",
+			queuedAgo:    time.Hour,
+			retry:        true,
+			count:        1,
+			wantTimedOut: true,
+			wantState:    cicd.DataStateValues.BuildFailed,
+		},
+		{
+			name:         "last attempt timed out",
+			queuedAgo:    time.Hour,
+			retry:        true,
+			count:        3,
+			wantTimedOut: true,
+			wantState:    cicd.DataStateValues.BuildTimedOut,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.Timeouts = &TimeoutConfig{BuildMinutes: 30, RetryBuild: tt.retry}
+			config.AksBuildRetry = &RetryPolicy{MaxAttempts: 3}
+			c, pipelineClient, _ := newTestClient(t, config)
+
+			build := pipelineClient.queue(2, "abc123", nil)
+			queued := time.Now().UTC().Add(-tt.queuedAgo)
+			data := &cicd.Data{
+				Date:     c.Today(),
+				State:    cicd.DataStateValues.BuildInProgress,
+				AKSBuild: &cicd.AKSBuild{ID: *build.Id, Count: tt.count, QueueTime: &queued},
+			}
+
+			timedOut, err := c.timeoutAKSBuild(context.Background(), pipelineClient, data, build, c.logger)
+			if err != nil {
+				t.Fatalf("timeoutAKSBuild() error = %v", err)
+			}
+			if timedOut != tt.wantTimedOut || data.AKSBuild.TimedOut != tt.wantTimedOut {
+				t.Errorf("timeoutAKSBuild() = %v, recorded %v, want %v", timedOut, data.AKSBuild.TimedOut, tt.wantTimedOut)
+			}
+			if canceled := len(pipelineClient.canceled) == 1; canceled != tt.wantTimedOut {
+				t.Errorf("canceled = %v, want %v", pipelineClient.canceled, tt.wantTimedOut)
+			}
+			if data.State != tt.wantState {
+				t.Errorf("state = %s, want %s", data.State, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestTimeoutStaging(t *testing.T) {
+	tests := []struct {
+		name        string
+		startedAgo  time.Duration
+		retriedAgo  time.Duration
+		retry       bool
+		retries     int
+		wantStatus  string
+		wantRetries int
+	}{
+		{
+			name:       "staging within its timeout",
+			startedAgo: 10 * time.Minute,
+			wantStatus: "inProgress",
+		},
+		{
+			name:       "staging timed out",
+			startedAgo: time.Hour,
+			wantStatus: cicd.StagingStatusTimedOut,
+		},
+		{
+			name:        "staging timed out with attempts left",
+			startedAgo:  time.Hour,
+			retry:       true,
+			wantStatus:  cicd.StagingStatusRetryPending,
+			wantRetries: 1,
+		},
+		{
+			name:        "last attempt timed out",
+			startedAgo:  time.Hour,
+			retry:       true,
+			retries:     1,
+			wantStatus:  cicd.StagingStatusTimedOut,
+			wantRetries: 1,
+		},
+		{
+			name:        "retry within its timeout",
+			startedAgo:  time.Hour,
+			retriedAgo:  10 * time.Minute,
+			retry:       true,
+			retries:     1,
+			wantStatus:  "inProgress",
+			wantRetries: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testConfig()
+			config.Timeouts = &TimeoutConfig{StagingMinutes: 30, RetryStaging: tt.retry}
+			config.ReleaseRetry = &RetryPolicy{MaxAttempts: 2}
+			c, _, releaseClient := newTestClient(t, config)
+
+			releaseID, environmentID := 1000, 10000
+			status := "inProgress"
+			started := time.Now().UTC().Add(-tt.startedAgo)
+			staging := &cicd.Staging{Stage: "release-10-staging", Name: "canary", Status: &status, StartTime: &started, TimeoutRetries: tt.retries}
+			if tt.retriedAgo > 0 {
+				retried := time.Now().UTC().Add(-tt.retriedAgo)
+				staging.RetriedAt = &retried
+			}
+			release := &cicd.AKSRelease{DefinitionID: 10, ReleaseID: &releaseID, Staging: []*cicd.Staging{staging}}
+			environment := &vstsrelease.ReleaseEnvironment{Id: &environmentID, Name: &staging.Name}
+
+			if err := c.timeoutStaging(context.Background(), releaseClient, release, staging, environment, c.logger); err != nil {
+				t.Fatalf("timeoutStaging() error = %v", err)
+			}
+			if *staging.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", *staging.Status, tt.wantStatus)
+			}
+			if staging.TimeoutRetries != tt.wantRetries {
+				t.Errorf("timeout retries = %d, want %d", staging.TimeoutRetries, tt.wantRetries)
+			}
+			canceled := tt.wantStatus != "inProgress"
+			if (len(releaseClient.updates) == 1) != canceled {
+				t.Errorf("updates = %v, want the deployment canceled %v", releaseClient.updates, canceled)
+			}
+			if tt.wantStatus == cicd.StagingStatusRetryPending && staging.RetryAfter == nil {
+				t.Error("no retry time was recorded")
+			}
+		})
+	}
+}
+
+// TestReconcileStagingTimeoutRetry walks a staging through its timeout and the deployment requested again
+func TestReconcileStagingTimeoutRetry(t *testing.T) {
+	config := testConfig()
+	config.Timeouts = &TimeoutConfig{StagingMinutes: 30, RetryStaging: true}
+	config.ReleaseRetry = &RetryPolicy{MaxAttempts: 2}
+	c, pipelineClient, releaseClient := newTestClient(t, config)
+	ctx := context.Background()
+	pipelineClient.validate(1, "abc123")
+
+	var data *cicd.Data
+	reconcile := func(want cicd.DataState) {
+		t.Helper()
+		var err error
+		if data, err = c.reconcile(ctx); err != nil {
+			t.Fatalf("reconcile() error = %v", err)
+		}
+		if data.State != want {
+			t.Fatalf("state = %s, want %s", data.State, want)
+		}
+	}
+	// update changes the stored data of the day as if time had passed
+	update := func(change func(*cicd.Data)) {
+		t.Helper()
+		change(data)
+		if _, err := c.UploadDataToBlob(ctx, data.Date, data, statestore.VersionAny); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reconcile(cicd.DataStateValues.NotStart)
+	reconcile(cicd.DataStateValues.BuildInProgress)
+	pipelineClient.complete(data.AKSBuild.ID, vstsbuild.BuildResultValues.Succeeded)
+	reconcile(cicd.DataStateValues.BuildSucceeded)
+	reconcile(cicd.DataStateValues.ReleaseInProgress)
+	releaseID := *data.AKSRelease[0].ReleaseID
+
+	update(func(d *cicd.Data) {
+		started := time.Now().UTC().Add(-time.Hour)
+		d.AKSRelease[0].StartTime = &started
+	})
+	reconcile(cicd.DataStateValues.ReleaseInProgress)
+	staging := data.AKSRelease[0].Staging[0]
+	if *staging.Status != cicd.StagingStatusRetryPending {
+		t.Fatalf("staging status = %s, want %s", *staging.Status, cicd.StagingStatusRetryPending)
+	}
+
+	// the staging is deployed again once the backoff passed and the abandoned deployment stopped
+	reconcile(cicd.DataStateValues.ReleaseInProgress)
+	if len(releaseClient.deployed) != 0 {
+		t.Fatalf("staging deployed again before the backoff passed")
+	}
+	update(func(d *cicd.Data) {
+		retryAfter := time.Now().UTC().Add(-time.Minute)
+		d.AKSRelease[0].Staging[0].RetryAfter = &retryAfter
+	})
+	reconcile(cicd.DataStateValues.ReleaseInProgress)
+	if len(releaseClient.deployed) != 0 {
+		t.Fatalf("staging deployed again while the abandoned deployment is running")
+	}
+	releaseClient.setStaging(releaseID, "canary", vstsrelease.EnvironmentStatusValues.Canceled)
+	reconcile(cicd.DataStateValues.ReleaseInProgress)
+	if len(releaseClient.deployed) != 1 {
+		t.Fatalf("deployed %d times, want the staging deployed again", len(releaseClient.deployed))
+	}
+
+	// the retry gets the whole timeout again and its outcome is the outcome of the staging
+	reconcile(cicd.DataStateValues.ReleaseInProgress)
+	releaseClient.setStaging(releaseID, "canary", vstsrelease.EnvironmentStatusValues.Succeeded)
+	reconcile(cicd.DataStateValues.ReleaseSucceeded)
+}
@@ -0,0 +1,138 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/pipelines"
+)
+
+// ValidationGate is a validation pipeline a commit must pass to be picked
+type ValidationGate struct {
+	PipelineID int `json:"pipeline_id"`
+
+	// Result is the worst accepted result of the build, succeeded or partiallySucceeded, defaults to succeeded
+	Result string `json:"result,omitempty"`
+
+	// Branch is the branch the build must have run on, any branch if empty
+	Branch string `json:"branch,omitempty"`
+}
+
+// accepts checks whether the result of build passes the gate
+func (g *ValidationGate) accepts(build *vstsbuild.Build) bool {
+	if build.Result == nil || build.SourceVersion == nil {
+		return false
+	}
+	switch *build.Result {
+	case vstsbuild.BuildResultValues.Succeeded:
+		return true
+	case vstsbuild.BuildResultValues.PartiallySucceeded:
+		return g.Result == string(vstsbuild.BuildResultValues.PartiallySucceeded)
+	}
+	return false
+}
+
+func (g *ValidationGate) validate() error {
+	if g.PipelineID == 0 {
+		return fmt.Errorf("pipeline_id is required")
+	}
+	switch g.Result {
+	case "", string(vstsbuild.BuildResultValues.Succeeded), string(vstsbuild.BuildResultValues.PartiallySucceeded):
+		return nil
+	}
+	return fmt.Errorf("result %q must be %s or %s", g.Result, vstsbuild.BuildResultValues.Succeeded, vstsbuild.BuildResultValues.PartiallySucceeded)
+}
+
+// gates returns the validation gates of a PickBuild stage, PipelineID is the first gate if set
+func (s *Stage) gates() []*ValidationGate {
+	if s.PipelineID == 0 {
+		return s.Gates
+	}
+	return append([]*ValidationGate{{PipelineID: s.PipelineID}}, s.Gates...)
+}
+
+// pickCommit returns the newest commit which passed all gates between minTime and maxTime, with the
+// build of each gate which validated it. Commits are ordered by the builds of the first gate, the
+// older ones are picked when the newer ones didn't pass all gates. An empty commit is returned if
+// no commit passed all gates.
+func (c *MonitorClient) pickCommit(
+	ctx context.Context,
+	pipelineClient pipelines.PipelineClient,
+	gates []*ValidationGate,
+	minTime time.Time,
+	maxTime time.Time,
+	logger logrus.FieldLogger,
+) (string, []*vstsbuild.Build, error) {
+	var (
+		commits []string
+		passed  = make([]map[string]*vstsbuild.Build, len(gates))
+	)
+	for i, g := range gates {
+		builds, err := pipelineClient.ListCompletedBuilds(ctx, g.PipelineID, g.Branch, minTime, maxTime)
+		if err != nil {
+			return "", nil, err
+		}
+
+		passed[i] = map[string]*vstsbuild.Build{}
+		for _, b := range builds {
+			if !g.accepts(b) {
+				continue
+			}
+			// builds are listed newest first, the newest build validating the commit is kept
+			if _, ok := passed[i][*b.SourceVersion]; ok {
+				continue
+			}
+			passed[i][*b.SourceVersion] = b
+			if i == 0 {
+				commits = append(commits, *b.SourceVersion)
+			}
+		}
+	}
+
+	for _, commit := range commits {
+		var validations []*vstsbuild.Build
+		for i := range gates {
+			if b, ok := passed[i][commit]; ok {
+				validations = append(validations, b)
+			}
+		}
+		if len(validations) == len(gates) {
+			return commit, validations, nil
+		}
+		logger.Infof("commit %s passed %d of %d validation gates, looking at older commits", commit, len(validations), len(gates))
+	}
+	return "", nil, nil
+}
+
+// recordValidations records the builds which validated the picked commit in data, validations are
+// the builds of gates in the same order
+func recordValidations(data *cicd.Data, gates []*ValidationGate, validations []*vstsbuild.Build) {
+	first := validations[0]
+	data.MasterValidation.Branch = first.SourceBranch
+	data.MasterValidation.CommitID = first.SourceVersion
+	data.MasterValidation.BuildID = first.Id
+	data.MasterValidation.BuildNumber = first.BuildNumber
+	data.MasterValidation.FinishTime = timeOf(first.FinishTime)
+
+	data.MasterValidation.Validations = nil
+	for i, b := range validations {
+		v := &cicd.Validation{
+			PipelineID:  gates[i].PipelineID,
+			BuildNumber: b.BuildNumber,
+			Branch:      b.SourceBranch,
+			FinishTime:  timeOf(b.FinishTime),
+		}
+		if b.Id != nil {
+			v.BuildID = *b.Id
+		}
+		if b.Result != nil {
+			result := string(*b.Result)
+			v.Result = &result
+		}
+		data.MasterValidation.Validations = append(data.MasterValidation.Validations, v)
+	}
+}
@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
+)
+
+// validationBuild is a completed build of a validation pipeline
+type validationBuild struct {
+	pipelineID int
+	commit     string
+	result     vstsbuild.BuildResult
+}
+
+func TestPickCommit(t *testing.T) {
+	succeeded := vstsbuild.BuildResultValues.Succeeded
+	failed := vstsbuild.BuildResultValues.Failed
+	partial := vstsbuild.BuildResultValues.PartiallySucceeded
+
+	tests := []struct {
+		name   string
+		gates  []*ValidationGate
+		builds []validationBuild
+		want   string
+	}{
+		{
+			name:  "newest commit passed every gate",
+			gates: []*ValidationGate{{PipelineID: 1}, {PipelineID: 3}},
+			builds: []validationBuild{
+				{1, "abc123", succeeded}, {3, "abc123", succeeded},
+				{1, "def456", succeeded}, {3, "def456", succeeded},
+			},
+			want: "def456",
+		},
+		{
+			name:  "newest commit failed a gate",
+			gates: []*ValidationGate{{PipelineID: 1}, {PipelineID: 3}},
+			builds: []validationBuild{
+				{1, "abc123", succeeded}, {3, "abc123", succeeded},
+				{1, "def456", succeeded}, {3, "def456", failed},
+			},
+			want: "abc123",
+		},
+		{
+			name:  "newest commit not validated by every gate yet",
+			gates: []*ValidationGate{{PipelineID: 1}, {PipelineID: 3}},
+			builds: []validationBuild{
+				{1, "abc123", succeeded}, {3, "abc123", succeeded},
+				{1, "def456", succeeded},
+			},
+			want: "abc123",
+		},
+		{
+			name:  "newest build of the first gate failed",
+			gates: []*ValidationGate{{PipelineID: 1}},
+			builds: []validationBuild{
+				{1, "abc123", succeeded},
+				{1, "def456", failed},
+			},
+			want: "abc123",
+		},
+		{
+			name:  "partially succeeded build accepted by the gate",
+			gates: []*ValidationGate{{PipelineID: 1}, {PipelineID: 3, Result: string(partial)}},
+			builds: []validationBuild{
+				{1, "abc123", succeeded}, {3, "abc123", partial},
+			},
+			want: "abc123",
+		},
+		{
+			name:  "partially succeeded build rejected by the gate",
+			gates: []*ValidationGate{{PipelineID: 1}, {PipelineID: 3}},
+			builds: []validationBuild{
+				{1, "abc123", succeeded}, {3, "abc123", partial},
+			},
+		},
+		{
+			name:  "no commit passed every gate",
+			gates: []*ValidationGate{{PipelineID: 1}, {PipelineID: 3}},
+			builds: []validationBuild{
+				{1, "abc123", succeeded}, {3, "abc123", failed},
+				{1, "def456", succeeded}, {3, "def456", failed},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, pipelineClient, _ := newTestClient(t, testConfig())
+			for _, b := range tt.builds {
+				pipelineClient.finish(b.pipelineID, b.commit, b.result)
+			}
+
+			now := time.Now()
+			commit, validations, err := c.pickCommit(context.Background(), pipelineClient, tt.gates, now.Add(-time.Hour), now, c.logger)
+			if err != nil {
+				t.Fatalf("pickCommit() error = %v", err)
+			}
+			if commit != tt.want {
+				t.Fatalf("pickCommit() = %q, want %q", commit, tt.want)
+			}
+			if commit == "" {
+				if validations != nil {
+					t.Errorf("pickCommit() validations = %v, want none", validations)
+				}
+				return
+			}
+			if len(validations) != len(tt.gates) {
+				t.Fatalf("pickCommit() returned %d validations, want one per gate", len(validations))
+			}
+			for i, v := range validations {
+				if *v.SourceVersion != commit || pipelineClient.pipelineOf(*v.Id) != tt.gates[i].PipelineID {
+					t.Errorf("validation %d is build %d of commit %s, want a build of pipeline %d for %s", i, *v.Id, *v.SourceVersion, tt.gates[i].PipelineID, commit)
+				}
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
 	vstspipelines "github.com/microsoft/azure-devops-go-api/azuredevops/pipelines"
 	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/metrics"
 	"github.com/yangzuo0621/monitor/pkg/vstspat"
 )
 
@@ -70,9 +71,11 @@ func (c *pipelineClient) ListPipelines(ctx context.Context) ([]*vstsbuild.BuildD
 		return nil, err
 	}
 
+	start := time.Now()
 	resp, err := buildClient.GetDefinitions(ctx, vstsbuild.GetDefinitionsArgs{
 		Project: &c.project,
 	})
+	metrics.ObserveAPICall("pipelines", "GetDefinitions", start, err)
 
 	if err != nil {
 		err = fmt.Errorf("get definitions failed: %w", err)
@@ -101,10 +104,12 @@ func (c *pipelineClient) GetPipelineByID(ctx context.Context, id int) (*vstsbuil
 		return nil, err
 	}
 
+	start := time.Now()
 	pipeline, err := buildClient.GetDefinition(ctx, vstsbuild.GetDefinitionArgs{
 		Project:      &c.project,
 		DefinitionId: &id,
 	})
+	metrics.ObserveAPICall("pipelines", "GetDefinition", start, err)
 	if err != nil {
 		err := fmt.Errorf("get build definition %d: %w", id, err)
 		logger.WithError(err).Error()
@@ -114,7 +119,7 @@ func (c *pipelineClient) GetPipelineByID(ctx context.Context, id int) (*vstsbuil
 	return pipeline, nil
 }
 
-func (c *pipelineClient) ListPipelineBuilds(ctx context.Context, pipelineID int) ([]*vstsbuild.Build, error) {
+func (c *pipelineClient) ListPipelineBuilds(ctx context.Context, pipelineID int, minTime time.Time, maxTime time.Time) ([]*vstsbuild.Build, error) {
 	logger := c.logger.WithFields(logrus.Fields{
 		"action":      "listPipelineBuilds",
 		"pipeline.id": pipelineID,
@@ -127,16 +132,20 @@ func (c *pipelineClient) ListPipelineBuilds(ctx context.Context, pipelineID int)
 	}
 
 	i := 10
-	now := time.Now().UTC()
-	yesterday := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.UTC)
-	resp, err := buildClient.GetBuilds(ctx, vstsbuild.GetBuildsArgs{
-		Project:     &c.project,
-		Definitions: &[]int{pipelineID},
-		MinTime:     &vsts.Time{Time: yesterday},
-		// MaxTime:      &vsts.Time{Time: time.Now()},
+	args := vstsbuild.GetBuildsArgs{
+		Project:      &c.project,
+		Definitions:  &[]int{pipelineID},
+		MinTime:      &vsts.Time{Time: minTime},
 		Top:          &i,
 		ResultFilter: &vstsbuild.BuildResultValues.Succeeded,
-	})
+		QueryOrder:   &vstsbuild.BuildQueryOrderValues.FinishTimeDescending,
+	}
+	if !maxTime.IsZero() {
+		args.MaxTime = &vsts.Time{Time: maxTime}
+	}
+	start := time.Now()
+	resp, err := buildClient.GetBuilds(ctx, args)
+	metrics.ObserveAPICall("pipelines", "GetBuilds", start, err)
 
 	if err != nil {
 		err = fmt.Errorf("get builds failed: %w", err)
@@ -153,6 +162,55 @@ func (c *pipelineClient) ListPipelineBuilds(ctx context.Context, pipelineID int)
 	return result, nil
 }
 
+func (c *pipelineClient) ListCompletedBuilds(ctx context.Context, pipelineID int, branch string, minTime time.Time, maxTime time.Time) ([]*vstsbuild.Build, error) {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":      "listCompletedBuilds",
+		"pipeline.id": pipelineID,
+		"branch":      branch,
+	})
+
+	buildClient, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	i := 50
+	args := vstsbuild.GetBuildsArgs{
+		Project:      &c.project,
+		Definitions:  &[]int{pipelineID},
+		MinTime:      &vsts.Time{Time: minTime},
+		Top:          &i,
+		StatusFilter: &vstsbuild.BuildStatusValues.Completed,
+		QueryOrder:   &vstsbuild.BuildQueryOrderValues.FinishTimeDescending,
+	}
+	if branch != "" {
+		if !strings.HasPrefix(branch, "refs/") {
+			branch = "refs/heads/" + branch
+		}
+		args.BranchName = &branch
+	}
+	if !maxTime.IsZero() {
+		args.MaxTime = &vsts.Time{Time: maxTime}
+	}
+	start := time.Now()
+	resp, err := buildClient.GetBuilds(ctx, args)
+	metrics.ObserveAPICall("pipelines", "GetBuilds", start, err)
+
+	if err != nil {
+		err = fmt.Errorf("list completed builds of pipeline %d failed: %w", pipelineID, err)
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	var result []*vstsbuild.Build
+	for _, v := range resp.Value {
+		value := v
+		result = append(result, &value)
+	}
+	return result, nil
+}
+
 func (c *pipelineClient) GetPipelineBuildByID(ctx context.Context, id int) (*vstsbuild.Build, error) {
 	logger := c.logger.WithFields(logrus.Fields{
 		"action":   "listPipelineBuilds",
@@ -165,10 +223,12 @@ func (c *pipelineClient) GetPipelineBuildByID(ctx context.Context, id int) (*vst
 		return nil, err
 	}
 
+	start := time.Now()
 	build, err := buildClient.GetBuild(ctx, vstsbuild.GetBuildArgs{
 		Project: &c.project,
 		BuildId: &id,
 	})
+	metrics.ObserveAPICall("pipelines", "GetBuild", start, err)
 
 	if err != nil {
 		err = fmt.Errorf("get build %d failed: %w", id, err)
@@ -179,6 +239,34 @@ func (c *pipelineClient) GetPipelineBuildByID(ctx context.Context, id int) (*vst
 	return build, nil
 }
 
+func (c *pipelineClient) GetBuildTimeline(ctx context.Context, buildID int) (*vstsbuild.Timeline, error) {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":   "getBuildTimeline",
+		"build.id": buildID,
+	})
+
+	buildClient, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	start := time.Now()
+	timeline, err := buildClient.GetBuildTimeline(ctx, vstsbuild.GetBuildTimelineArgs{
+		Project: &c.project,
+		BuildId: &buildID,
+	})
+	metrics.ObserveAPICall("pipelines", "GetBuildTimeline", start, err)
+
+	if err != nil {
+		err = fmt.Errorf("get timeline of build %d failed: %w", buildID, err)
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	return timeline, nil
+}
+
 func (c *pipelineClient) TriggerPipelineBuild(ctx context.Context, pipelineID int, branch string, variables []string) (*vstspipelines.Run, error) {
 	logger := c.logger.WithFields(logrus.Fields{
 		"action":      "listPipelineBuilds",
@@ -205,6 +293,7 @@ func (c *pipelineClient) TriggerPipelineBuild(ctx context.Context, pipelineID in
 		}
 	}
 
+	start := time.Now()
 	resp, err := pipelineClient.RunPipeline(ctx, vstspipelines.RunPipelineArgs{
 		Project:    &c.project,
 		PipelineId: &pipelineID,
@@ -219,6 +308,7 @@ func (c *pipelineClient) TriggerPipelineBuild(ctx context.Context, pipelineID in
 			Variables: &vars,
 		},
 	})
+	metrics.ObserveAPICall("pipelines", "RunPipeline", start, err)
 
 	if err != nil {
 		err = fmt.Errorf("trigger pipeline %d failed: %w", pipelineID, err)
@@ -234,6 +324,7 @@ func (c *pipelineClient) QueueBuildByBranch(
 	definitionID int,
 	branch string,
 	variables map[string]string,
+	tags []string,
 ) (*vstsbuild.Build, error) {
 	logger := c.logger.WithFields(logrus.Fields{
 		"action":      "QueueBuildByBranch",
@@ -248,6 +339,7 @@ func (c *pipelineClient) QueueBuildByBranch(
 
 	content, _ := json.Marshal(variables)
 	contentStr := string(content)
+	start := time.Now()
 	build, err := buildClient.QueueBuild(ctx, vstsbuild.QueueBuildArgs{
 		Build: &vstsbuild.Build{
 			Definition: &vstsbuild.DefinitionReference{
@@ -255,9 +347,11 @@ func (c *pipelineClient) QueueBuildByBranch(
 			},
 			SourceBranch: &branch,
 			Parameters:   &contentStr,
+			Tags:         &tags,
 		},
 		Project: &c.project,
 	})
+	metrics.ObserveAPICall("pipelines", "QueueBuild", start, err)
 
 	if err != nil {
 		err = fmt.Errorf("queue build %d for branch %s failed: %w", definitionID, branch, err)
@@ -273,6 +367,7 @@ func (c *pipelineClient) QueueBuildByCommit(
 	definitionID int,
 	gitCommit string,
 	variables map[string]string,
+	tags []string,
 ) (*vstsbuild.Build, error) {
 	logger := c.logger.WithFields(logrus.Fields{
 		"action":      "QueueBuildByCommit",
@@ -287,6 +382,7 @@ func (c *pipelineClient) QueueBuildByCommit(
 
 	content, _ := json.Marshal(variables)
 	contentStr := string(content)
+	start := time.Now()
 	build, err := buildClient.QueueBuild(ctx, vstsbuild.QueueBuildArgs{
 		Build: &vstsbuild.Build{
 			Definition: &vstsbuild.DefinitionReference{
@@ -294,9 +390,11 @@ func (c *pipelineClient) QueueBuildByCommit(
 			},
 			SourceVersion: &gitCommit,
 			Parameters:    &contentStr,
+			Tags:          &tags,
 		},
 		Project: &c.project,
 	})
+	metrics.ObserveAPICall("pipelines", "QueueBuild", start, err)
 
 	if err != nil {
 		err = fmt.Errorf("queue build %d for git commit %s failed: %w", definitionID, gitCommit, err)
@@ -307,6 +405,98 @@ func (c *pipelineClient) QueueBuildByCommit(
 	return build, nil
 }
 
+func (c *pipelineClient) AddBuildTags(ctx context.Context, buildID int, tags []string) error {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":   "AddBuildTags",
+		"build.id": buildID,
+	})
+
+	buildClient, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+
+	start := time.Now()
+	_, err = buildClient.AddBuildTags(ctx, vstsbuild.AddBuildTagsArgs{
+		Project: &c.project,
+		BuildId: &buildID,
+		Tags:    &tags,
+	})
+	metrics.ObserveAPICall("pipelines", "AddBuildTags", start, err)
+	if err != nil {
+		err = fmt.Errorf("add tags to build %d failed: %w", buildID, err)
+		logger.WithError(err).Error()
+		return err
+	}
+	return nil
+}
+
+func (c *pipelineClient) CancelBuild(ctx context.Context, buildID int) error {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":   "cancelBuild",
+		"build.id": buildID,
+	})
+
+	buildClient, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+
+	start := time.Now()
+	_, err = buildClient.UpdateBuild(ctx, vstsbuild.UpdateBuildArgs{
+		Project: &c.project,
+		BuildId: &buildID,
+		Build: &vstsbuild.Build{
+			Status: &vstsbuild.BuildStatusValues.Cancelling,
+		},
+	})
+	metrics.ObserveAPICall("pipelines", "UpdateBuild", start, err)
+	if err != nil {
+		err = fmt.Errorf("cancel build %d failed: %w", buildID, err)
+		logger.WithError(err).Error()
+		return err
+	}
+	return nil
+}
+
+func (c *pipelineClient) ListBuildsByTag(ctx context.Context, pipelineID int, tag string, minTime time.Time) ([]*vstsbuild.Build, error) {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":      "listBuildsByTag",
+		"pipeline.id": pipelineID,
+		"tag":         tag,
+	})
+
+	buildClient, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := buildClient.GetBuilds(ctx, vstsbuild.GetBuildsArgs{
+		Project:     &c.project,
+		Definitions: &[]int{pipelineID},
+		TagFilters:  &[]string{tag},
+		MinTime:     &vsts.Time{Time: minTime},
+		QueryOrder:  &vstsbuild.BuildQueryOrderValues.QueueTimeDescending,
+	})
+	metrics.ObserveAPICall("pipelines", "GetBuilds", start, err)
+	if err != nil {
+		err = fmt.Errorf("list builds of pipeline %d tagged %s failed: %w", pipelineID, tag, err)
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	var result []*vstsbuild.Build
+	for _, v := range resp.Value {
+		value := v
+		result = append(result, &value)
+	}
+	return result, nil
+}
+
 func (c *pipelineClient) GetArtifactsByBuildID(ctx context.Context, buildID int) (*[]vstsbuild.BuildArtifact, error) {
 	logger := c.logger.WithFields(logrus.Fields{
 		"action":   "listPipelineBuilds",
@@ -319,10 +509,13 @@ func (c *pipelineClient) GetArtifactsByBuildID(ctx context.Context, buildID int)
 		return nil, err
 	}
 
-	return buildClient.GetArtifacts(ctx, vstsbuild.GetArtifactsArgs{
+	start := time.Now()
+	artifacts, err := buildClient.GetArtifacts(ctx, vstsbuild.GetArtifactsArgs{
 		Project: &c.project,
 		BuildId: &buildID,
 	})
+	metrics.ObserveAPICall("pipelines", "GetArtifacts", start, err)
+	return artifacts, err
 }
 
 func BuildPipelineClient(rootLogger logrus.FieldLogger, patProvider vstspat.PATProvider, org string, project string) (PipelineClient, error) {
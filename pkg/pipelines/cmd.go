@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -162,7 +163,9 @@ func createListPipelineBuildsCommand() *cobra.Command {
 				return err
 			}
 
-			builds, err := pipelineClient.ListPipelineBuilds(ctx, pipelineID)
+			now := time.Now().UTC()
+			yesterday := time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.UTC)
+			builds, err := pipelineClient.ListPipelineBuilds(ctx, pipelineID, yesterday, time.Time{})
 			if err != nil {
 				return err
 			}
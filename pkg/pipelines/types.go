@@ -2,6 +2,7 @@ package pipelines
 
 import (
 	"context"
+	"time"
 
 	vstsbuild "github.com/microsoft/azure-devops-go-api/azuredevops/build"
 	vstspipelines "github.com/microsoft/azure-devops-go-api/azuredevops/pipelines"
@@ -15,20 +16,37 @@ type PipelineClient interface {
 	// GetPipelineByID gets a pipeline by id.
 	GetPipelineByID(ctx context.Context, id int) (*vstsbuild.BuildDefinition, error)
 
-	// ListPipelineBuilds lists builds of pipeline.
-	ListPipelineBuilds(ctx context.Context, pipelineID int) ([]*vstsbuild.Build, error)
+	// ListPipelineBuilds lists the newest succeeded builds of pipeline which finished between minTime
+	// and maxTime, maxTime is ignored if zero.
+	ListPipelineBuilds(ctx context.Context, pipelineID int, minTime time.Time, maxTime time.Time) ([]*vstsbuild.Build, error)
+
+	// ListCompletedBuilds lists the newest completed builds of pipeline on branch which finished
+	// between minTime and maxTime, whatever their result. branch is ignored if empty, maxTime if zero.
+	ListCompletedBuilds(ctx context.Context, pipelineID int, branch string, minTime time.Time, maxTime time.Time) ([]*vstsbuild.Build, error)
 
 	// GetPipelineBuildByID gets a build of pipeline by id
 	GetPipelineBuildByID(ctx context.Context, id int) (*vstsbuild.Build, error)
 
+	// GetBuildTimeline gets the timeline records of a build
+	GetBuildTimeline(ctx context.Context, buildID int) (*vstsbuild.Timeline, error)
+
 	// TriggerPipelineBuild creates a build intance of specified pipeline.
 	TriggerPipelineBuild(ctx context.Context, pipelineID int, branch string, variables []string) (*vstspipelines.Run, error)
 
-	// QueueBuildByBranch creates a build instance of specified pipeline with branch.
-	QueueBuildByBranch(ctx context.Context, pipelineID int, branch string, variables map[string]string) (*vstsbuild.Build, error)
+	// QueueBuildByBranch creates a build instance of specified pipeline with branch, tagged with tags.
+	QueueBuildByBranch(ctx context.Context, pipelineID int, branch string, variables map[string]string, tags []string) (*vstsbuild.Build, error)
+
+	// QueueBuildByBranch creates a build instance of specified pipeline with git commit, tagged with tags.
+	QueueBuildByCommit(ctx context.Context, pipelineID int, gitCommit string, variables map[string]string, tags []string) (*vstsbuild.Build, error)
+
+	// CancelBuild cancels a build which is queued or running.
+	CancelBuild(ctx context.Context, buildID int) error
+
+	// AddBuildTags adds tags to a build.
+	AddBuildTags(ctx context.Context, buildID int, tags []string) error
 
-	// QueueBuildByBranch creates a build instance of specified pipeline with git commit.
-	QueueBuildByCommit(ctx context.Context, pipelineID int, gitCommit string, variables map[string]string) (*vstsbuild.Build, error)
+	// ListBuildsByTag lists builds of pipeline queued since minTime which have tag.
+	ListBuildsByTag(ctx context.Context, pipelineID int, tag string, minTime time.Time) ([]*vstsbuild.Build, error)
 
 	GetArtifactsByBuildID(ctx context.Context, buildID int) (*[]vstsbuild.BuildArtifact, error)
 }
@@ -3,10 +3,12 @@ package releases
 import (
 	"context"
 	"fmt"
+	"time"
 
 	vsts "github.com/microsoft/azure-devops-go-api/azuredevops"
 	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
 	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/metrics"
 	"github.com/yangzuo0621/monitor/pkg/vstspat"
 )
 
@@ -56,10 +58,12 @@ func (c *releaseClient) GetReleaseByID(ctx context.Context, releaseID int) (*vst
 		return nil, err
 	}
 
+	start := time.Now()
 	release, err := client.GetRelease(ctx, vstsrelease.GetReleaseArgs{
 		Project:   &c.project,
 		ReleaseId: &releaseID,
 	})
+	metrics.ObserveAPICall("releases", "GetRelease", start, err)
 	if err != nil {
 		err := fmt.Errorf("get release %d: %w", releaseID, err)
 		logger.WithError(err).Error()
@@ -79,6 +83,7 @@ func (c *releaseClient) CreateRelease(ctx context.Context, definitionID int, ali
 		return nil, err
 	}
 
+	start := time.Now()
 	release, err := client.CreateRelease(ctx, vstsrelease.CreateReleaseArgs{
 		Project: &c.project,
 		ReleaseStartMetadata: &vstsrelease.ReleaseStartMetadata{
@@ -95,6 +100,7 @@ func (c *releaseClient) CreateRelease(ctx context.Context, definitionID int, ali
 			},
 		},
 	})
+	metrics.ObserveAPICall("releases", "CreateRelease", start, err)
 
 	if err != nil {
 		logger.WithError(err).Error()
@@ -114,10 +120,12 @@ func (c *releaseClient) ListReleases(ctx context.Context, releaseIDs []int) ([]*
 		return nil, err
 	}
 
+	start := time.Now()
 	resp, err := client.GetReleases(ctx, vstsrelease.GetReleasesArgs{
 		Project:         &c.project,
 		ReleaseIdFilter: &releaseIDs,
 	})
+	metrics.ObserveAPICall("releases", "GetReleases", start, err)
 	if err != nil {
 		err = fmt.Errorf("get Releases failed: %w", err)
 		logger.WithError(err).Error()
@@ -133,6 +141,207 @@ func (c *releaseClient) ListReleases(ctx context.Context, releaseIDs []int) ([]*
 	return result, nil
 }
 
+func (c *releaseClient) ListReleasesByDefinition(ctx context.Context, definitionID int, minCreatedTime time.Time) ([]*vstsrelease.Release, error) {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":        "ListReleasesByDefinition",
+		"definition.id": definitionID,
+	})
+
+	client, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := client.GetReleases(ctx, vstsrelease.GetReleasesArgs{
+		Project:        &c.project,
+		DefinitionId:   &definitionID,
+		MinCreatedTime: &vsts.Time{Time: minCreatedTime},
+	})
+	metrics.ObserveAPICall("releases", "GetReleases", start, err)
+	if err != nil {
+		err = fmt.Errorf("get releases of definition %d failed: %w", definitionID, err)
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	var result []*vstsrelease.Release
+	for _, v := range resp.Value {
+		value := v
+		result = append(result, &value)
+	}
+	return result, nil
+}
+
+func (c *releaseClient) CancelReleaseEnvironment(ctx context.Context, releaseID int, environmentID int, comment string) error {
+	return c.updateReleaseEnvironment(ctx, "CancelReleaseEnvironment", releaseID, environmentID, vstsrelease.EnvironmentStatusValues.Canceled, comment)
+}
+
+func (c *releaseClient) DeployReleaseEnvironment(ctx context.Context, releaseID int, environmentID int, comment string) error {
+	return c.updateReleaseEnvironment(ctx, "DeployReleaseEnvironment", releaseID, environmentID, vstsrelease.EnvironmentStatusValues.InProgress, comment)
+}
+
+// updateReleaseEnvironment moves an environment of release to status
+func (c *releaseClient) updateReleaseEnvironment(ctx context.Context, action string, releaseID int, environmentID int, status vstsrelease.EnvironmentStatus, comment string) error {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":         action,
+		"release.id":     releaseID,
+		"environment.id": environmentID,
+	})
+
+	client, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+
+	start := time.Now()
+	_, err = client.UpdateReleaseEnvironment(ctx, vstsrelease.UpdateReleaseEnvironmentArgs{
+		Project:       &c.project,
+		ReleaseId:     &releaseID,
+		EnvironmentId: &environmentID,
+		EnvironmentUpdateData: &vstsrelease.ReleaseEnvironmentUpdateMetadata{
+			Status:  &status,
+			Comment: &comment,
+		},
+	})
+	metrics.ObserveAPICall("releases", "UpdateReleaseEnvironment", start, err)
+	if err != nil {
+		err = fmt.Errorf("update environment %d of release %d to %s failed: %w", environmentID, releaseID, status, err)
+		logger.WithError(err).Error()
+		return err
+	}
+	return nil
+}
+
+func (c *releaseClient) ApproveRelease(ctx context.Context, approvalID int, comment string) error {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":      "ApproveRelease",
+		"approval.id": approvalID,
+	})
+
+	client, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+
+	start := time.Now()
+	_, err = client.UpdateReleaseApproval(ctx, vstsrelease.UpdateReleaseApprovalArgs{
+		Project:    &c.project,
+		ApprovalId: &approvalID,
+		Approval: &vstsrelease.ReleaseApproval{
+			Status:   &vstsrelease.ApprovalStatusValues.Approved,
+			Comments: &comment,
+		},
+	})
+	metrics.ObserveAPICall("releases", "UpdateReleaseApproval", start, err)
+	if err != nil {
+		err = fmt.Errorf("approve approval %d failed: %w", approvalID, err)
+		logger.WithError(err).Error()
+		return err
+	}
+	return nil
+}
+
+func (c *releaseClient) ListManualInterventions(ctx context.Context, releaseID int) ([]*vstsrelease.ManualIntervention, error) {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":     "ListManualInterventions",
+		"release.id": releaseID,
+	})
+
+	client, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	start := time.Now()
+	resp, err := client.GetManualInterventions(ctx, vstsrelease.GetManualInterventionsArgs{
+		Project:   &c.project,
+		ReleaseId: &releaseID,
+	})
+	metrics.ObserveAPICall("releases", "GetManualInterventions", start, err)
+	if err != nil {
+		err = fmt.Errorf("get manual interventions of release %d failed: %w", releaseID, err)
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	var result []*vstsrelease.ManualIntervention
+	if resp != nil {
+		for _, v := range *resp {
+			value := v
+			result = append(result, &value)
+		}
+	}
+	return result, nil
+}
+
+func (c *releaseClient) UpdateManualIntervention(ctx context.Context, releaseID int, interventionID int, status vstsrelease.ManualInterventionStatus, comment string) (*vstsrelease.ManualIntervention, error) {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":          "UpdateManualIntervention",
+		"release.id":      releaseID,
+		"intervention.id": interventionID,
+		"status":          status,
+	})
+
+	client, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return nil, err
+	}
+
+	start := time.Now()
+	intervention, err := client.UpdateManualIntervention(ctx, vstsrelease.UpdateManualInterventionArgs{
+		Project:              &c.project,
+		ReleaseId:            &releaseID,
+		ManualInterventionId: &interventionID,
+		ManualInterventionUpdateMetadata: &vstsrelease.ManualInterventionUpdateMetadata{
+			Status:  &status,
+			Comment: &comment,
+		},
+	})
+	metrics.ObserveAPICall("releases", "UpdateManualIntervention", start, err)
+	if err != nil {
+		err = fmt.Errorf("update manual intervention %d of release %d to %s failed: %w", interventionID, releaseID, status, err)
+		logger.WithError(err).Error()
+		return nil, err
+	}
+	return intervention, nil
+}
+
+func (c *releaseClient) IgnoreGates(ctx context.Context, gateStepID int, gates []string, comment string) error {
+	logger := c.logger.WithFields(logrus.Fields{
+		"action":       "IgnoreGates",
+		"gate_step.id": gateStepID,
+	})
+
+	client, err := c.buildClient(ctx)
+	if err != nil {
+		logger.WithError(err).Error()
+		return err
+	}
+
+	start := time.Now()
+	_, err = client.UpdateGates(ctx, vstsrelease.UpdateGatesArgs{
+		Project:    &c.project,
+		GateStepId: &gateStepID,
+		GateUpdateMetadata: &vstsrelease.GateUpdateMetadata{
+			Comment:       &comment,
+			GatesToIgnore: &gates,
+		},
+	})
+	metrics.ObserveAPICall("releases", "UpdateGates", start, err)
+	if err != nil {
+		err = fmt.Errorf("ignore gates %v of gate step %d failed: %w", gates, gateStepID, err)
+		logger.WithError(err).Error()
+		return err
+	}
+	return nil
+}
+
 // BuildReleaseClient creates an instance of ReleaseClient
 func BuildReleaseClient(rootLogger logrus.FieldLogger, patProvider vstspat.PATProvider, org string, project string) (ReleaseClient, error) {
 	logger := rootLogger.WithFields(logrus.Fields{
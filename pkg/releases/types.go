@@ -2,6 +2,7 @@ package releases
 
 import (
 	"context"
+	"time"
 
 	vstsrelease "github.com/microsoft/azure-devops-go-api/azuredevops/release"
 )
@@ -11,4 +12,29 @@ type ReleaseClient interface {
 	GetReleaseByID(ctx context.Context, releaseID int) (*vstsrelease.Release, error)
 	ListReleases(ctx context.Context, releaseIDs []int) ([]*vstsrelease.Release, error)
 	CreateRelease(ctx context.Context, definitionID int, alias string, buildID string, buildNumber string, description string) (*vstsrelease.Release, error)
+
+	// ListReleasesByDefinition lists releases of definition created since minCreatedTime
+	ListReleasesByDefinition(ctx context.Context, definitionID int, minCreatedTime time.Time) ([]*vstsrelease.Release, error)
+
+	// CancelReleaseEnvironment abandons the deployment of an environment of release, comment is
+	// recorded in the release
+	CancelReleaseEnvironment(ctx context.Context, releaseID int, environmentID int, comment string) error
+
+	// DeployReleaseEnvironment starts the deployment of an environment of release, comment is
+	// recorded in the release
+	DeployReleaseEnvironment(ctx context.Context, releaseID int, environmentID int, comment string) error
+
+	// ApproveRelease approves a pending approval of a release with comment
+	ApproveRelease(ctx context.Context, approvalID int, comment string) error
+
+	// ListManualInterventions lists the manual interventions of all the environments of release
+	ListManualInterventions(ctx context.Context, releaseID int) ([]*vstsrelease.ManualIntervention, error)
+
+	// UpdateManualIntervention resumes or rejects a manual intervention of release with comment, the
+	// updated manual intervention is returned
+	UpdateManualIntervention(ctx context.Context, releaseID int, interventionID int, status vstsrelease.ManualInterventionStatus, comment string) (*vstsrelease.ManualIntervention, error)
+
+	// IgnoreGates ignores gates of a gate step so that the deployment goes on, comment is recorded
+	// in the release
+	IgnoreGates(ctx context.Context, gateStepID int, gates []string, comment string) error
 }
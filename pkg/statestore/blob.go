@@ -0,0 +1,106 @@
+package statestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/storageaccountv2"
+)
+
+type blobStateStore struct {
+	blobClient storageaccountv2.BlobClient
+
+	logger logrus.FieldLogger
+}
+
+// BuildBlobStateStore creates a StateStore backed by azure storage account blobs
+func BuildBlobStateStore(blobClient storageaccountv2.BlobClient, rootLogger logrus.FieldLogger) StateStore {
+	logger := rootLogger.WithFields(logrus.Fields{
+		"source": "blob state store",
+	})
+	return &blobStateStore{
+		blobClient: blobClient,
+		logger:     logger,
+	}
+}
+
+func (s *blobStateStore) GetData(ctx context.Context, key string) (*cicd.Data, string, error) {
+	logger := s.logger.WithFields(logrus.Fields{
+		"action": "GetData",
+		"blob":   key,
+	})
+
+	if !s.blobClient.BlobExists(ctx, key) {
+		return nil, VersionNone, ErrNotFound
+	}
+
+	blob, etag, err := s.blobClient.GetBlob(ctx, key)
+	if err != nil {
+		err = fmt.Errorf("get blob %s: %w", key, err)
+		logger.WithError(err).Error()
+		return nil, VersionNone, err
+	}
+
+	var data cicd.Data
+	err = json.Unmarshal(blob, &data)
+	if err != nil {
+		err = fmt.Errorf("unmarshal blob %s: %w", key, err)
+		logger.WithError(err).Error()
+		return nil, VersionNone, err
+	}
+	return &data, string(etag), nil
+}
+
+func (s *blobStateStore) PutData(ctx context.Context, key string, data *cicd.Data, version string) (string, error) {
+	logger := s.logger.WithFields(logrus.Fields{
+		"action":  "PutData",
+		"blob":    key,
+		"version": version,
+	})
+
+	content, err := json.MarshalIndent(data, "", " ")
+	if err != nil {
+		logger.WithError(err).Error()
+		return VersionNone, err
+	}
+
+	conditions := azblob.ModifiedAccessConditions{}
+	switch version {
+	case VersionAny:
+	case VersionNone:
+		conditions.IfNoneMatch = azblob.ETagAny
+	default:
+		conditions.IfMatch = azblob.ETag(version)
+	}
+
+	etag, err := s.blobClient.UploadBlob(ctx, key, content, conditions)
+	if errors.Is(err, storageaccountv2.ErrConditionNotMet) {
+		return VersionNone, ErrConflict
+	}
+	if err != nil {
+		err = fmt.Errorf("upload blob %s: %w", key, err)
+		logger.WithError(err).Error()
+		return VersionNone, err
+	}
+	return string(etag), nil
+}
+
+func (s *blobStateStore) Ping(ctx context.Context) error {
+	container, err := s.blobClient.GetContainerURL()
+	if err != nil {
+		return err
+	}
+
+	_, err = container.GetProperties(ctx, azblob.LeaseAccessConditions{})
+	if err != nil {
+		return fmt.Errorf("get properties of container: %w", err)
+	}
+	return nil
+}
+
+var _ StateStore = (*blobStateStore)(nil)
@@ -0,0 +1,165 @@
+package statestore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+type fileStateStore struct {
+	directory string
+
+	// mu serializes the version check and the write, files modified by other processes in between
+	// aren't detected
+	mu sync.Mutex
+
+	logger logrus.FieldLogger
+}
+
+// BuildFileStateStore creates a StateStore which keeps one JSON file per key in directory
+func BuildFileStateStore(directory string, rootLogger logrus.FieldLogger) (StateStore, error) {
+	logger := rootLogger.WithFields(logrus.Fields{
+		"source":    "file state store",
+		"directory": directory,
+	})
+
+	if directory == "" {
+		return nil, fmt.Errorf("directory of file state store is not set")
+	}
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, fmt.Errorf("create directory %s: %w", directory, err)
+	}
+
+	return &fileStateStore{
+		directory: directory,
+		logger:    logger,
+	}, nil
+}
+
+func (s *fileStateStore) path(key string) string {
+	return filepath.Join(s.directory, key+".json")
+}
+
+// version returns the version of the file content, which is its hash
+func version(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8])
+}
+
+// currentVersion returns the version of the file of key, VersionNone if it doesn't exist
+func (s *fileStateStore) currentVersion(key string) (string, error) {
+	content, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return VersionNone, nil
+	}
+	if err != nil {
+		return VersionNone, err
+	}
+	return version(content), nil
+}
+
+func (s *fileStateStore) GetData(ctx context.Context, key string) (*cicd.Data, string, error) {
+	logger := s.logger.WithFields(logrus.Fields{
+		"action": "GetData",
+		"key":    key,
+	})
+
+	content, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, VersionNone, ErrNotFound
+	}
+	if err != nil {
+		logger.WithError(err).Error()
+		return nil, VersionNone, err
+	}
+
+	var data cicd.Data
+	err = json.Unmarshal(content, &data)
+	if err != nil {
+		err = fmt.Errorf("unmarshal %s: %w", s.path(key), err)
+		logger.WithError(err).Error()
+		return nil, VersionNone, err
+	}
+	return &data, version(content), nil
+}
+
+func (s *fileStateStore) PutData(ctx context.Context, key string, data *cicd.Data, expected string) (string, error) {
+	logger := s.logger.WithFields(logrus.Fields{
+		"action":  "PutData",
+		"key":     key,
+		"version": expected,
+	})
+
+	content, err := json.MarshalIndent(data, "", " ")
+	if err != nil {
+		logger.WithError(err).Error()
+		return VersionNone, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expected != VersionAny {
+		current, err := s.currentVersion(key)
+		if err != nil {
+			logger.WithError(err).Error()
+			return VersionNone, err
+		}
+		if current != expected {
+			return VersionNone, ErrConflict
+		}
+	}
+
+	// keys may contain a prefix such as "<flow>/", which is mapped to a sub directory
+	path := s.path(key)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		logger.WithError(err).Error()
+		return VersionNone, err
+	}
+
+	// write to a temporary file first so that readers never see a partial document
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		logger.WithError(err).Error()
+		return VersionNone, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		logger.WithError(err).Error()
+		return VersionNone, err
+	}
+	if err = tmp.Close(); err != nil {
+		logger.WithError(err).Error()
+		return VersionNone, err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		logger.WithError(err).Error()
+		return VersionNone, err
+	}
+	return version(content), nil
+}
+
+func (s *fileStateStore) Ping(ctx context.Context) error {
+	info, err := os.Stat(s.directory)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.directory)
+	}
+	return nil
+}
+
+var _ StateStore = (*fileStateStore)(nil)
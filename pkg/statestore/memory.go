@@ -0,0 +1,74 @@
+package statestore
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+type memoryItem struct {
+	content []byte
+	version int
+}
+
+type memoryStateStore struct {
+	mu    sync.RWMutex
+	items map[string]memoryItem
+}
+
+// BuildMemoryStateStore creates a StateStore which keeps data in process memory
+func BuildMemoryStateStore() StateStore {
+	return &memoryStateStore{
+		items: map[string]memoryItem{},
+	}
+}
+
+func (s *memoryStateStore) GetData(ctx context.Context, key string) (*cicd.Data, string, error) {
+	s.mu.RLock()
+	item, ok := s.items[key]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, VersionNone, ErrNotFound
+	}
+
+	// data is kept serialized so callers never share pointers with the store
+	var data cicd.Data
+	if err := json.Unmarshal(item.content, &data); err != nil {
+		return nil, VersionNone, err
+	}
+	return &data, strconv.Itoa(item.version), nil
+}
+
+func (s *memoryStateStore) PutData(ctx context.Context, key string, data *cicd.Data, version string) (string, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return VersionNone, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[key]
+	current := VersionNone
+	if ok {
+		current = strconv.Itoa(item.version)
+	}
+	if version != VersionAny && version != current {
+		return VersionNone, ErrConflict
+	}
+
+	item = memoryItem{
+		content: content,
+		version: item.version + 1,
+	}
+	s.items[key] = item
+	return strconv.Itoa(item.version), nil
+}
+
+func (s *memoryStateStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+var _ StateStore = (*memoryStateStore)(nil)
@@ -0,0 +1,147 @@
+package statestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/sirupsen/logrus"
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+	"github.com/yangzuo0621/monitor/pkg/storageaccountv2"
+)
+
+// fakeBlobClient keeps blobs in memory and honors the conditions of UploadBlob the way azure does
+type fakeBlobClient struct {
+	storageaccountv2.BlobClient
+
+	mu    sync.Mutex
+	blobs map[string][]byte
+	etags map[string]azblob.ETag
+	next  int
+}
+
+func (c *fakeBlobClient) BlobExists(ctx context.Context, blobName string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.blobs[blobName]
+	return ok
+}
+
+func (c *fakeBlobClient) GetBlob(ctx context.Context, blobName string) ([]byte, azblob.ETag, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	content, ok := c.blobs[blobName]
+	if !ok {
+		return nil, azblob.ETagNone, fmt.Errorf("blob %s not found", blobName)
+	}
+	return content, c.etags[blobName], nil
+}
+
+func (c *fakeBlobClient) UploadBlob(ctx context.Context, blobName string, content []byte, conditions azblob.ModifiedAccessConditions) (azblob.ETag, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	etag, exists := c.etags[blobName]
+	if conditions.IfNoneMatch == azblob.ETagAny && exists {
+		return azblob.ETagNone, storageaccountv2.ErrConditionNotMet
+	}
+	if conditions.IfMatch != azblob.ETagNone && conditions.IfMatch != etag {
+		return azblob.ETagNone, storageaccountv2.ErrConditionNotMet
+	}
+
+	c.next++
+	etag = azblob.ETag(fmt.Sprintf("\"0x%d\"", c.next))
+	c.blobs[blobName] = content
+	c.etags[blobName] = etag
+	return etag, nil
+}
+
+func TestStateStores(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+
+	directory, err := ioutil.TempDir("", "statestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+	fileStore, err := BuildFileStateStore(directory, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]StateStore{
+		TypeMemory: BuildMemoryStateStore(),
+		TypeFile:   fileStore,
+		TypeBlob: BuildBlobStateStore(&fakeBlobClient{
+			blobs: map[string][]byte{},
+			etags: map[string]azblob.ETag{},
+		}, logger),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			testStateStore(t, store)
+		})
+	}
+}
+
+// testStateStore checks the contract of StateStore which every backend must follow
+func testStateStore(t *testing.T, store StateStore) {
+	ctx := context.Background()
+	const key = "test-2021-03-01"
+
+	if _, _, err := store.GetData(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetData() of missing data error = %v, want ErrNotFound", err)
+	}
+
+	data := &cicd.Data{Date: "2021-03-01", State: cicd.DataStateValues.NotStart}
+	if _, err := store.PutData(ctx, key, data, "stale"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("PutData() of missing data at a version error = %v, want ErrConflict", err)
+	}
+	v1, err := store.PutData(ctx, key, data, VersionNone)
+	if err != nil {
+		t.Fatalf("PutData() create error = %v", err)
+	}
+	if _, err := store.PutData(ctx, key, data, VersionNone); !errors.Is(err, ErrConflict) {
+		t.Fatalf("PutData() create of existing data error = %v, want ErrConflict", err)
+	}
+
+	got, version, err := store.GetData(ctx, key)
+	if err != nil {
+		t.Fatalf("GetData() error = %v", err)
+	}
+	if version != v1 || got.Date != data.Date || got.State != data.State {
+		t.Fatalf("GetData() = %+v at %s, want %+v at %s", got, version, data, v1)
+	}
+
+	data.State = cicd.DataStateValues.BuildInProgress
+	v2, err := store.PutData(ctx, key, data, v1)
+	if err != nil {
+		t.Fatalf("PutData() update error = %v", err)
+	}
+	if v2 == v1 {
+		t.Fatalf("PutData() update kept version %s", v1)
+	}
+
+	data.State = cicd.DataStateValues.BuildFailed
+	if _, err := store.PutData(ctx, key, data, v1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("PutData() at a stale version error = %v, want ErrConflict", err)
+	}
+	v3, err := store.PutData(ctx, key, data, VersionAny)
+	if err != nil {
+		t.Fatalf("PutData() at any version error = %v", err)
+	}
+
+	got, version, err = store.GetData(ctx, key)
+	if err != nil {
+		t.Fatalf("GetData() error = %v", err)
+	}
+	if version != v3 || got.State != cicd.DataStateValues.BuildFailed {
+		t.Errorf("GetData() = %s at %s, want %s at %s", got.State, version, cicd.DataStateValues.BuildFailed, v3)
+	}
+}
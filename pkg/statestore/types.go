@@ -0,0 +1,49 @@
+package statestore
+
+import (
+	"context"
+	"errors"
+
+	"github.com/yangzuo0621/monitor/pkg/cicd"
+)
+
+const (
+	// TypeBlob stores data in azure storage account blobs
+	TypeBlob = "blob"
+
+	// TypeFile stores data as JSON files in a local directory
+	TypeFile = "file"
+
+	// TypeMemory keeps data in process memory, mainly for dry runs and tests
+	TypeMemory = "memory"
+)
+
+const (
+	// VersionNone is the version of data which doesn't exist yet, PutData only creates it
+	VersionNone = ""
+
+	// VersionAny makes PutData overwrite the data whatever its version
+	VersionAny = "*"
+)
+
+var (
+	// ErrNotFound is returned when no data is stored under the requested key
+	ErrNotFound = errors.New("state not found")
+
+	// ErrConflict is returned when the stored data isn't at the version expected by PutData
+	ErrConflict = errors.New("state was modified concurrently")
+)
+
+// StateStore interface for persisting the CI/CD data of each day. Every write changes the version
+// of the data, writers pass the version they read so that concurrent updates aren't lost.
+type StateStore interface {
+	// GetData gets the data stored under key and its version, returns ErrNotFound if it doesn't exist
+	GetData(ctx context.Context, key string) (*cicd.Data, string, error)
+
+	// PutData creates or updates the data stored under key if it is still at version, returns
+	// ErrConflict otherwise. The new version is returned.
+	PutData(ctx context.Context, key string, data *cicd.Data, version string) (string, error)
+
+	// Ping checks whether the backend of the store is reachable
+	Ping(ctx context.Context) error
+}
@@ -5,8 +5,8 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
 	"github.com/sirupsen/logrus"
@@ -64,29 +64,29 @@ func (c *blobClient) BlobExists(ctx context.Context, blobName string) bool {
 	return true
 }
 
-func (c *blobClient) GetBlob(ctx context.Context, blobName string) ([]byte, error) {
+func (c *blobClient) GetBlob(ctx context.Context, blobName string) ([]byte, azblob.ETag, error) {
 	container, err := c.GetContainerURL()
 	if err != nil {
-		return nil, err
+		return nil, azblob.ETagNone, err
 	}
 	blob := container.NewBlobURL(blobName)
 
 	resp, err := blob.Download(ctx, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false)
 	if err != nil {
-		return nil, err
+		return nil, azblob.ETagNone, err
 	}
 	defer resp.Response().Body.Close()
 	body, err := ioutil.ReadAll(resp.Body(azblob.RetryReaderOptions{}))
 	if err != nil {
-		return nil, err
+		return nil, azblob.ETagNone, err
 	}
-	return body, nil
+	return body, resp.ETag(), nil
 }
 
-func (c *blobClient) UploadBlob(ctx context.Context, blobName string, content []byte) (int, error) {
+func (c *blobClient) UploadBlob(ctx context.Context, blobName string, content []byte, conditions azblob.ModifiedAccessConditions) (azblob.ETag, error) {
 	container, err := c.GetContainerURL()
 	if err != nil {
-		return http.StatusBadRequest, err
+		return azblob.ETagNone, err
 	}
 	blob := container.NewBlobURL(blobName)
 
@@ -95,12 +95,78 @@ func (c *blobClient) UploadBlob(ctx context.Context, blobName string, content []
 		bytes.NewReader(content),
 		azblob.BlobHTTPHeaders{},
 		azblob.Metadata{},
-		azblob.BlobAccessConditions{})
+		azblob.BlobAccessConditions{ModifiedAccessConditions: conditions})
+
+	if isStorageError(err, azblob.ServiceCodeConditionNotMet, azblob.ServiceCodeBlobAlreadyExists) {
+		return azblob.ETagNone, ErrConditionNotMet
+	}
+	if err != nil {
+		return azblob.ETagNone, err
+	}
+	return resp.ETag(), nil
+}
+
+func (c *blobClient) AcquireLease(ctx context.Context, blobName string, leaseID string, duration time.Duration) error {
+	container, err := c.GetContainerURL()
+	if err != nil {
+		return err
+	}
+	blob := container.NewBlobURL(blobName)
+
+	// a lease can only be taken on an existing blob, the condition keeps the content of an existing one
+	_, err = blob.ToBlockBlobURL().Upload(
+		ctx,
+		bytes.NewReader(nil),
+		azblob.BlobHTTPHeaders{},
+		azblob.Metadata{},
+		azblob.BlobAccessConditions{
+			ModifiedAccessConditions: azblob.ModifiedAccessConditions{IfNoneMatch: azblob.ETagAny},
+		})
+	if err != nil && !isStorageError(err, azblob.ServiceCodeBlobAlreadyExists, azblob.ServiceCodeConditionNotMet, azblob.ServiceCodeLeaseIDMissing) {
+		return err
+	}
 
+	_, err = blob.AcquireLease(ctx, leaseID, int32(duration/time.Second), azblob.ModifiedAccessConditions{})
+	if isStorageError(err, azblob.ServiceCodeLeaseAlreadyPresent) {
+		return ErrLeaseAlreadyPresent
+	}
+	return err
+}
+
+func (c *blobClient) RenewLease(ctx context.Context, blobName string, leaseID string) error {
+	container, err := c.GetContainerURL()
+	if err != nil {
+		return err
+	}
+	blob := container.NewBlobURL(blobName)
+
+	_, err = blob.RenewLease(ctx, leaseID, azblob.ModifiedAccessConditions{})
+	return err
+}
+
+func (c *blobClient) ReleaseLease(ctx context.Context, blobName string, leaseID string) error {
+	container, err := c.GetContainerURL()
 	if err != nil {
-		return http.StatusBadRequest, err
+		return err
+	}
+	blob := container.NewBlobURL(blobName)
+
+	_, err = blob.ReleaseLease(ctx, leaseID, azblob.ModifiedAccessConditions{})
+	return err
+}
+
+// isStorageError checks whether err is a storage error with one of codes
+func isStorageError(err error, codes ...azblob.ServiceCodeType) bool {
+	storageErr, ok := err.(azblob.StorageError)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if storageErr.ServiceCode() == code {
+			return true
+		}
 	}
-	return resp.StatusCode(), nil
+	return false
 }
 
 var _ BlobClient = (*blobClient)(nil)
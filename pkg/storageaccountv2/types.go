@@ -2,10 +2,20 @@ package storageaccountv2
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/Azure/azure-storage-blob-go/azblob"
 )
 
+var (
+	// ErrLeaseAlreadyPresent is returned when the lease of a blob is held by someone else
+	ErrLeaseAlreadyPresent = errors.New("lease is already present")
+
+	// ErrConditionNotMet is returned when a conditional upload finds the blob modified or already existing
+	ErrConditionNotMet = errors.New("condition not met")
+)
+
 // BlobClient interface for manuplate Blob of storage account container
 type BlobClient interface {
 	// GetContainerURL return destination Container
@@ -14,9 +24,19 @@ type BlobClient interface {
 	// BlobExists check whether the blob exists
 	BlobExists(ctx context.Context, blobName string) bool
 
-	// GetBlob get the contents of blob
-	GetBlob(ctx context.Context, blobName string) ([]byte, error)
+	// GetBlob get the contents of blob and its ETag
+	GetBlob(ctx context.Context, blobName string) ([]byte, azblob.ETag, error)
+
+	// UploadBlob create or update blob content if conditions are met, returns ErrConditionNotMet otherwise.
+	// The new ETag of blob is returned.
+	UploadBlob(ctx context.Context, blobName string, content []byte, conditions azblob.ModifiedAccessConditions) (azblob.ETag, error)
+
+	// AcquireLease acquires or renews the lease leaseID on blob for duration, the blob is created if it doesn't exist
+	AcquireLease(ctx context.Context, blobName string, leaseID string, duration time.Duration) error
+
+	// RenewLease renews the lease leaseID held on blob
+	RenewLease(ctx context.Context, blobName string, leaseID string) error
 
-	// UploadBlob create or update blob content
-	UploadBlob(ctx context.Context, blobName string, content []byte) (int, error)
+	// ReleaseLease releases the lease leaseID held on blob so that others can acquire it immediately
+	ReleaseLease(ctx context.Context, blobName string, leaseID string) error
 }